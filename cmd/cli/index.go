@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"template/internal/store"
+	"template/pkg/infra/mongo"
+
+	"github.com/pkg/errors"
+)
+
+// index 检查和同步 mongodb 索引: cli -mongo hosts -mongodb db index status|sync|prune
+func index(args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: cli index status|sync|prune")
+	}
+
+	opts := mongo.SyncIndexOptions{}
+	switch args[0] {
+	case "status":
+	case "sync":
+		opts.Create = true
+	case "prune":
+		opts.Create, opts.Drop = true, true
+	default:
+		return errors.Errorf("unknown index command '%v'", args[0])
+	}
+
+	cli, err := mongo.NewClient(&mongo.Config{
+		Hosts:       strings.Split(mongoHosts, ","),
+		Database:    mongoDatabase,
+		MaxPoolSize: 1,
+	})
+	if err != nil {
+		return err
+	}
+	defer cli.Close(context.Background())
+
+	report, err := store.SyncIndexes(context.Background(), cli, opts)
+	if report != nil {
+		printIndexes("missing", report.Missing)
+		printIndexes("extra", report.Extra)
+		printIndexes("mismatched", report.Mismatched)
+		printIndexes("created", report.Created)
+		printIndexes("dropped", report.Dropped)
+	}
+	return err
+}
+
+func printIndexes(state string, names []string) {
+	for _, name := range names {
+		fmt.Printf("%-10s %s\n", state, name)
+	}
+}
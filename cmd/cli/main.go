@@ -5,16 +5,17 @@ import (
 	"context"
 	"encoding/base64"
 	"encoding/binary"
+	"flag"
 	"fmt"
 	"io/ioutil"
 	"math/rand"
 	"net/http"
 	"time"
 
+	"template/pkg/infra/discovery"
 	"template/pkg/proto"
 
 	microhttp "github.com/asim/go-micro/plugins/client/http/v3"
-	"github.com/asim/go-micro/plugins/registry/consul/v3"
 	"github.com/asim/go-micro/plugins/selector/shard/v3"
 	"github.com/asim/go-micro/plugins/transport/grpc/v3"
 	"github.com/asim/go-micro/plugins/wrapper/breaker/hystrix/v3"
@@ -27,16 +28,19 @@ import (
 )
 
 var (
+	consulAddr string
+	standalone bool
+	mysqlDSN   string
+
+	mongoHosts    string
+	mongoDatabase string
+
 	emptyData = struct{}{}
 
 	data  = []byte("giny")
 	magic = uint32(data[3]) | (uint32(data[2]) << 8) | (uint32(data[1]) << 16) | (uint32(data[0]) << 24)
 )
 
-const (
-	consulAddr = "127.0.0.1:8500"
-)
-
 type Response struct {
 	Code    int    `json:"code"`
 	Message string `json:"message"`
@@ -106,7 +110,29 @@ func benchmark() {
 	}
 }
 
+func init() {
+	flag.StringVar(&consulAddr, "consul", "127.0.0.1:8500", "consul address")
+	flag.BoolVar(&standalone, "standalone", false, "discover services by mdns instead of consul")
+	flag.StringVar(&mongoHosts, "mongo", "127.0.0.1:27017", "mongodb hosts for index, comma separated")
+	flag.StringVar(&mongoDatabase, "mongodb", "ffa", "mongodb database for index")
+	flag.StringVar(&mysqlDSN, "mysql", "root:Admin123@tcp(127.0.0.1:3306)/db_player?charset=utf8mb4", "mysql dsn for migrate")
+	flag.Parse()
+}
+
 func main() {
+	switch flag.Arg(0) {
+	case "migrate":
+		if err := migrate(flag.Args()[1:]); err != nil {
+			log.Fatal().Err(err).Msg("migrate failed")
+		}
+		return
+	case "index":
+		if err := index(flag.Args()[1:]); err != nil {
+			log.Fatal().Err(err).Msg("index failed")
+		}
+		return
+	}
+
 	webCli()
 	rpcCli()
 
@@ -117,8 +143,7 @@ func main() {
 }
 
 func webCli() {
-	reg := consul.NewRegistry(
-		registry.Addrs(consulAddr),
+	reg := discovery.NewRegistry(standalone, consulAddr,
 		registry.Timeout(time.Second*10),
 	)
 
@@ -152,9 +177,7 @@ func webCli() {
 func rpcCli() {
 	cli := client.NewClient(
 		client.Selector(selector.NewSelector(
-			selector.Registry(consul.NewRegistry(
-				registry.Addrs(consulAddr),
-			)),
+			selector.Registry(discovery.NewRegistry(standalone, consulAddr)),
 		)),
 		client.Transport(grpc.NewTransport()),
 		client.Retries(3),
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"template/internal/store"
+	"template/pkg/infra/mysql"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+)
+
+// migrate 执行 db_player 的表结构迁移: cli -mysql dsn migrate up|down [n]|status
+func migrate(args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: cli migrate up|down [n]|status")
+	}
+
+	db, err := sqlx.Open("mysql", mysqlDSN)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	migrator, err := store.NewMigrator(db)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	switch args[0] {
+	case "up":
+		done, err := migrator.Up(ctx)
+		printMigrations("applied", done)
+		return err
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			if steps, err = strconv.Atoi(args[1]); err != nil || steps <= 0 {
+				return errors.Errorf("invalid steps '%v'", args[1])
+			}
+		}
+
+		done, err := migrator.Down(ctx, steps)
+		printMigrations("reverted", done)
+		return err
+	case "status":
+		status, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+
+		for _, st := range status {
+			appliedAt := "pending"
+			if st.Applied {
+				appliedAt = st.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%04d %-32s %s\n", st.Version, st.Name, appliedAt)
+		}
+		return nil
+	default:
+		return errors.Errorf("unknown migrate command '%v'", args[0])
+	}
+}
+
+func printMigrations(action string, migrations []mysql.Migration) {
+	for _, mig := range migrations {
+		fmt.Printf("%s %04d %s\n", action, mig.Version, mig.Name)
+	}
+}
@@ -13,20 +13,23 @@ import (
 	"github.com/gin-gonic/gin"
 
 	"template/internal/client/rpc"
+	"template/pkg/infra/discovery"
 	"template/pkg/proto"
 )
 
 var (
 	consulAddr string
+	standalone bool
 )
 
 func init() {
 	flag.StringVar(&consulAddr, "consul", "127.0.0.1:8500", "consul address")
+	flag.BoolVar(&standalone, "standalone", false, "discover services by mdns instead of consul")
 	flag.Parse()
 }
 
 func main() {
-	cli := rpc.NewGreeterClient(consulAddr)
+	cli := rpc.NewGreeterClient(discovery.NewRegistry(standalone, consulAddr))
 	gin.SetMode(gin.ReleaseMode)
 	r := gin.New()
 	r.GET("/", func(c *gin.Context) {
@@ -14,13 +14,14 @@ func main() {
 	srv, err := app.New(
 		app.Config(),
 		app.Version(version),
+		app.KVStore(),
 		app.NodeID(),
 		app.Logger(),
-		app.KVStore(),
 		app.Monitor(),
 		app.RedisCli(),
 		app.MySQLCli(),
 		app.MongoCli(),
+		app.ShardCli(),
 		app.Dao(),
 		app.UseCase(),
 		app.WebService(),
@@ -39,6 +40,11 @@ func main() {
 
 	ch := make(chan os.Signal, 1)
 	signal.Notify(ch, syscall.SIGTERM, syscall.SIGINT, syscall.SIGQUIT)
-	err = srv.Run(ch)
+	if err = srv.Run(ch); err != nil {
+		_ = srv.Stop()
+		return
+	}
+
 	<-ch
+	err = srv.Stop()
 }
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"net/http"
 	"strings"
+	"time"
 
 	"template/internal/api/rest/docs"
 	"template/internal/api/rest/internal"
@@ -18,6 +19,11 @@ import (
 
 var _ Handler = (*restHandler)(nil)
 
+const (
+	userLockTTL      = 3 * time.Second // 自动续期，只影响进程崩溃后锁的释放时间
+	userLockFenceKey = "userLockFence"
+)
+
 type Handler interface {
 	RegisterHandler(engine *gin.Engine) error
 }
@@ -131,18 +137,22 @@ func (c *restHandler) tryLockUser(ctx *gin.Context) {
 		return
 	}
 
-	dLock := c.useCase.NewDistLock(userID)
-	if !dLock.TryLock(5, 50) {
+	lease, err := c.useCase.NewDistLock(userID).TryLock(ctx.Request.Context(), userLockTTL, 5, 50*time.Millisecond)
+	if err != nil {
 		c.ResponseWithCode(ctx, internal.CodeLockFailure)
-		log.Error().Str("userId", userID).Str("URL", ctx.Request.URL.Path).Msg("failed to lock user")
+		log.Error().Err(err).Str("userId", userID).Str("URL", ctx.Request.URL.Path).Msg("failed to lock user")
 		ctx.Abort()
 		return
 	}
 
+	// 锁丢失后下游调用随之取消，写存储时可以用 fencing token 拒绝过期的写入
+	ctx.Request = ctx.Request.WithContext(lease.Context())
+	ctx.Set(userLockFenceKey, lease.Token())
 	ctx.Next()
 
-	if !dLock.UnLock() {
-		log.Error().Str("userId", userID).Str("URL", ctx.Request.URL.Path).Msg("failed to unlock user")
+	if err = lease.Unlock(); err != nil {
+		log.Error().Err(err).Str("userId", userID).Str("URL", ctx.Request.URL.Path).
+			Int64("fence", lease.Token()).Msg("failed to unlock user")
 	}
 }
 
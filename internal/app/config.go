@@ -1,12 +1,26 @@
 package app
 
 import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
 )
 
 const (
-	redisModeCluster = "cluster"
-	// redisModeStandalone = "standalone"
+	redisConfKey = "redis"
+	mysqlConfKey = "mysql"
+	mongoConfKey = "mongodb"
+	shardConfKey = "shard"
+
+	redisModeCluster    = "cluster"
+	redisModeSentinel   = "sentinel"
+	redisModeStandalone = "standalone"
 )
 
 // ConfigObserver 动态更新
@@ -20,14 +34,186 @@ func (f ConfigHandler) OnConfigChanged(key string, data []byte) error {
 	return f(key, data)
 }
 
+// duration 配置中的时长，支持 "500ms"、"1m" 这样的字符串，数字按秒处理
+type duration time.Duration
+
+func (d duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *duration) UnmarshalJSON(data []byte) error {
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+
+	switch value := v.(type) {
+	case float64:
+		*d = duration(value * float64(time.Second))
+	case string:
+		dur, err := time.ParseDuration(value)
+		if err != nil {
+			return errors.Wrapf(err, "invalid duration %v", value)
+		}
+		*d = duration(dur)
+	default:
+		return errors.Errorf("invalid duration %s", data)
+	}
+
+	return nil
+}
+
+// or 未配置时使用默认值
+func (d duration) or(def time.Duration) time.Duration {
+	if d <= 0 {
+		return def
+	}
+	return time.Duration(d)
+}
+
+func intOr(v, def int) int {
+	if v <= 0 {
+		return def
+	}
+	return v
+}
+
 type redisConf struct {
-	Mode     string `json:"mode"`
-	Addr     string `json:"addr"`
+	Mode     string `json:"mode"` // standalone、cluster、sentinel
+	Addr     string `json:"addr"` // 多个地址用逗号分隔，兼容旧配置
 	Password string `json:"password"`
+
+	// Addrs 集群模式为种子节点，哨兵模式为哨兵地址，配置后忽略 Addr
+	Addrs            []string `json:"addrs,omitempty"`
+	MasterName       string   `json:"masterName,omitempty"`
+	SentinelPassword string   `json:"sentinelPassword,omitempty"`
+	DB               int      `json:"db,omitempty"` // 集群模式只支持 0
+	TLS              *tlsConf `json:"tls,omitempty"`
+
+	// 连接池，未配置时使用默认值
+	PoolSize     int      `json:"poolSize,omitempty"`
+	MinIdleConns int      `json:"minIdleConns,omitempty"`
+	MaxRetries   int      `json:"maxRetries,omitempty"`
+	DialTimeout  duration `json:"dialTimeout,omitempty"`
+	ReadTimeout  duration `json:"readTimeout,omitempty"`
+	WriteTimeout duration `json:"writeTimeout,omitempty"`
+	PoolTimeout  duration `json:"poolTimeout,omitempty"`
+	MaxConnAge   duration `json:"maxConnAge,omitempty"`
+	IdleTimeout  duration `json:"idleTimeout,omitempty"`
+
+	// SlowThreshold 慢命令阈值，默认 100ms
+	SlowThreshold duration `json:"slowThreshold,omitempty"`
+
+	// Redlock 相互独立的 redis 主节点，至少 3 个，用于 NewRedLock
+	Redlock []*redisConf `json:"redlock,omitempty"`
+}
+
+// mask Info 的内容会出现在错误和 /debug/config 中，不能包含密码
+func mask(password string) string {
+	if password == "" {
+		return ""
+	}
+	return "******"
 }
 
+// Info 用于日志和错误信息，密码已脱敏
 func (r *redisConf) Info() string {
-	return fmt.Sprintf("mode:%v addr:%v password:%v", r.Mode, r.Addr, r.Password)
+	return fmt.Sprintf("mode:%v addrs:%v master:%v db:%v tls:%v password:%v redlock:%v",
+		r.Mode, r.addrs(), r.MasterName, r.DB, r.TLS != nil, mask(r.Password), len(r.Redlock))
+}
+
+func (r *redisConf) addrs() []string {
+	if len(r.Addrs) > 0 {
+		return r.Addrs
+	}
+
+	addrs := make([]string, 0)
+	for _, addr := range strings.Split(r.Addr, ",") {
+		if addr = strings.TrimSpace(addr); addr != "" {
+			addrs = append(addrs, addr)
+		}
+	}
+	return addrs
+}
+
+// Validate 校验不同模式下必须的配置
+func (r *redisConf) Validate() error {
+	if len(r.addrs()) == 0 {
+		return errors.New("redis addr is empty")
+	}
+
+	switch r.Mode {
+	case "", redisModeStandalone:
+	case redisModeCluster:
+		if r.DB != 0 {
+			return errors.Errorf("redis cluster only supports db 0, got %v", r.DB)
+		}
+	case redisModeSentinel:
+		if r.MasterName == "" {
+			return errors.New("redis sentinel needs masterName")
+		}
+	default:
+		return errors.Errorf("unknown redis mode '%v'", r.Mode)
+	}
+
+	if len(r.Redlock) > 0 && len(r.Redlock) < 3 {
+		return errors.Errorf("redlock needs at least 3 nodes, got %v", len(r.Redlock))
+	}
+
+	for i, node := range r.Redlock {
+		if len(node.Redlock) > 0 {
+			return errors.Errorf("redlock node %v can not have redlock nodes", i)
+		}
+
+		if err := node.Validate(); err != nil {
+			return errors.Wrapf(err, "redlock node %v", i)
+		}
+	}
+
+	return nil
+}
+
+// tlsConf 证书为空时使用系统根证书
+type tlsConf struct {
+	CAFile             string `json:"caFile,omitempty"`
+	CertFile           string `json:"certFile,omitempty"`
+	KeyFile            string `json:"keyFile,omitempty"`
+	ServerName         string `json:"serverName,omitempty"`
+	InsecureSkipVerify bool   `json:"insecureSkipVerify,omitempty"`
+}
+
+func (t *tlsConf) config() (*tls.Config, error) {
+	if t == nil {
+		return nil, nil
+	}
+
+	conf := &tls.Config{
+		ServerName:         t.ServerName,
+		InsecureSkipVerify: t.InsecureSkipVerify,
+		MinVersion:         tls.VersionTLS12,
+	}
+
+	if t.CAFile != "" {
+		pem, err := ioutil.ReadFile(t.CAFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "read ca file")
+		}
+
+		conf.RootCAs = x509.NewCertPool()
+		if !conf.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, errors.Errorf("no certificate found in %v", t.CAFile)
+		}
+	}
+
+	if t.CertFile != "" || t.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(t.CertFile, t.KeyFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "load client certificate")
+		}
+		conf.Certificates = []tls.Certificate{cert}
+	}
+
+	return conf, nil
 }
 
 type mysqlConf struct {
@@ -36,11 +222,26 @@ type mysqlConf struct {
 	User     string `json:"user"`
 	Password string `json:"password"`
 	Database string `json:"database"`
+
+	// Replicas 从库地址 host:port，读请求轮询从库
+	Replicas []string `json:"replicas,omitempty"`
+
+	// 连接池，未配置时使用默认值
+	MaxOpenConns int      `json:"maxOpenConns,omitempty"`
+	MaxIdleConns int      `json:"maxIdleConns,omitempty"`
+	MaxLifetime  duration `json:"maxLifetime,omitempty"`
+	IdleTimeout  duration `json:"idleTimeout,omitempty"`
+	DialTimeout  duration `json:"dialTimeout,omitempty"`
+	ReadTimeout  duration `json:"readTimeout,omitempty"`
+	WriteTimeout duration `json:"writeTimeout,omitempty"`
+
+	// SlowThreshold 慢查询阈值，默认 500ms
+	SlowThreshold duration `json:"slowThreshold,omitempty"`
 }
 
 func (m *mysqlConf) Info() string {
-	return fmt.Sprintf("host:%v port:%v user:%v password:%v db:%v",
-		m.Host, m.Port, m.User, m.Password, m.Database)
+	return fmt.Sprintf("host:%v port:%v replicas:%v user:%v password:%v db:%v",
+		m.Host, m.Port, m.Replicas, m.User, mask(m.Password), m.Database)
 }
 
 type mongodbConf struct {
@@ -49,11 +250,18 @@ type mongodbConf struct {
 	Password   string   `json:"password"`
 	AuthSource string   `json:"authSource"`
 	Database   string   `json:"database"`
+
+	// 连接池，未配置时使用默认值
+	MaxPoolSize    int      `json:"maxPoolSize,omitempty"`
+	MinPoolSize    int      `json:"minPoolSize,omitempty"`
+	MaxIdleTime    duration `json:"maxIdleTime,omitempty"`
+	ConnectTimeout duration `json:"connectTimeout,omitempty"`
+	SocketTimeout  duration `json:"socketTimeout,omitempty"`
 }
 
 func (m *mongodbConf) Info() string {
 	return fmt.Sprintf("host:%v user:%v password:%v db:%v",
-		m.Host, m.User, m.Password, m.Database)
+		m.Host, m.User, mask(m.Password), m.Database)
 }
 
 type webConf struct {
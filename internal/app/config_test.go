@@ -0,0 +1,19 @@
+package app
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestConfInfoMasksPassword(t *testing.T) {
+	const password = "Admin123"
+	for _, info := range []string{
+		(&redisConf{Addr: "127.0.0.1:6379", Password: password}).Info(),
+		(&mysqlConf{Host: "127.0.0.1", Password: password}).Info(),
+		(&mongodbConf{Host: []string{"127.0.0.1:27017"}, Password: password}).Info(),
+	} {
+		if strings.Contains(info, password) {
+			t.Fatalf("password leaked in %v", info)
+		}
+	}
+}
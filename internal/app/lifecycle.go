@@ -0,0 +1,168 @@
+package app
+
+import (
+	"context"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+// 组件之间的依赖名称
+const (
+	depConfig  = "config"
+	depNodeID  = "nodeId"
+	depLogger  = "logger"
+	depKVStore = "kvStore"
+	depMonitor = "monitor"
+	depRedis   = "redis"
+	depMySQL   = "mysql"
+	depMongo   = "mongodb"
+	depShard   = "shard"
+	depDao     = "dao"
+	depUseCase = "useCase"
+	depRpcSvc  = "rpcService"
+	depWebSvc  = "webService"
+)
+
+// Option 描述一个组件：提供什么、依赖什么，以及如何初始化
+type Option struct {
+	name     string
+	provides []string
+	requires []string
+	apply    func(*app) error
+}
+
+// Hook 组件生命周期钩子，OnStart 按依赖顺序执行，OnStop 按逆序执行
+type Hook struct {
+	Name    string
+	OnStart func(ctx context.Context) error
+	OnStop  func(ctx context.Context) error
+}
+
+// sortOptions 按依赖关系对组件排序，没有依赖关系的组件保持传入顺序
+func sortOptions(options []Option) ([]Option, error) {
+	providers := make(map[string]int, len(options))
+	for i, opt := range options {
+		for _, p := range opt.provides {
+			if j, ok := providers[p]; ok {
+				return nil, errors.Errorf("%q is provided by both %s and %s", p, options[j].name, opt.name)
+			}
+			providers[p] = i
+		}
+	}
+
+	deps := make([][]int, len(options))
+	for i, opt := range options {
+		for _, r := range opt.requires {
+			j, ok := providers[r]
+			if !ok {
+				return nil, errors.Errorf("%s requires %q, but no option provides it", opt.name, r)
+			}
+			deps[i] = append(deps[i], j)
+		}
+	}
+
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+
+	state := make([]int, len(options))
+	sorted := make([]Option, 0, len(options))
+	path := make([]string, 0, len(options))
+
+	var visit func(i int) error
+	visit = func(i int) error {
+		switch state[i] {
+		case visited:
+			return nil
+		case visiting:
+			// 截取环上的路径
+			for k, name := range path {
+				if name == options[i].name {
+					cycle := append(path[k:], options[i].name)
+					return errors.Errorf("circular dependency: %s", strings.Join(cycle, " -> "))
+				}
+			}
+		}
+
+		state[i] = visiting
+		path = append(path, options[i].name)
+		for _, j := range deps[i] {
+			if err := visit(j); err != nil {
+				return err
+			}
+		}
+		path = path[:len(path)-1]
+		state[i] = visited
+		sorted = append(sorted, options[i])
+
+		return nil
+	}
+
+	for i := range options {
+		if err := visit(i); err != nil {
+			return nil, err
+		}
+	}
+
+	return sorted, nil
+}
+
+// appendHook 注册生命周期钩子
+func (a *app) appendHook(hook Hook) {
+	a.hooks = append(a.hooks, hook)
+}
+
+// start 按注册顺序执行 OnStart，失败时逆序停止已经启动的钩子；
+// 有 OnStart 的钩子回滚后或没有启动时不再参与 stop，只有释放资源的钩子留给 stop
+func (a *app) start(ctx context.Context) error {
+	for i, hook := range a.hooks {
+		if hook.OnStart == nil {
+			continue
+		}
+
+		if err := hook.OnStart(ctx); err != nil {
+			a.rollback(ctx, i)
+			return errors.Wrapf(err, "start %s", hook.Name)
+		}
+	}
+
+	return nil
+}
+
+// rollback 逆序停止 hooks[:n] 中已经启动的钩子，hooks[n:] 没有启动
+func (a *app) rollback(ctx context.Context, n int) {
+	for i := len(a.hooks) - 1; i >= 0; i-- {
+		hook := &a.hooks[i]
+		if hook.OnStart == nil || hook.OnStop == nil {
+			continue
+		}
+
+		if i < n {
+			if err := hook.OnStop(ctx); err != nil {
+				log.Err(err).Str("name", hook.Name).Msg("rollback hook")
+			}
+		}
+		hook.OnStop = nil
+	}
+}
+
+func (a *app) stop(ctx context.Context) (result error) {
+	for i := len(a.hooks) - 1; i >= 0; i-- {
+		hook := a.hooks[i]
+		if hook.OnStop == nil {
+			continue
+		}
+
+		if err := hook.OnStop(ctx); err != nil {
+			log.Err(err).Str("name", hook.Name).Msg("stop hook")
+			result = err
+		}
+	}
+	a.hooks = nil
+
+	return
+}
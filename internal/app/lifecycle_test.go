@@ -0,0 +1,174 @@
+package app
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func opt(name string, provides, requires []string) Option {
+	return Option{name: name, provides: provides, requires: requires}
+}
+
+func TestSortOptions(t *testing.T) {
+	cases := []struct {
+		name    string
+		options []Option
+		want    []string // 排序后的组件名
+		err     string   // 错误信息包含的内容
+	}{
+		{
+			name: "independent keep order",
+			options: []Option{
+				opt("c", []string{"c"}, nil),
+				opt("a", []string{"a"}, nil),
+				opt("b", []string{"b"}, nil),
+			},
+			want: []string{"c", "a", "b"},
+		},
+		{
+			name: "dependency first",
+			options: []Option{
+				opt("dao", []string{"dao"}, []string{"redis", "mysql"}),
+				opt("mysql", []string{"mysql"}, []string{"config"}),
+				opt("redis", []string{"redis"}, []string{"config"}),
+				opt("config", []string{"config"}, nil),
+				opt("web", nil, nil),
+			},
+			want: []string{"config", "redis", "mysql", "dao", "web"},
+		},
+		{
+			name: "missing provider",
+			options: []Option{
+				opt("dao", []string{"dao"}, []string{"redis"}),
+			},
+			err: `dao requires "redis", but no option provides it`,
+		},
+		{
+			name: "duplicate provider",
+			options: []Option{
+				opt("redis1", []string{"redis"}, nil),
+				opt("redis2", []string{"redis"}, nil),
+			},
+			err: `"redis" is provided by both redis1 and redis2`,
+		},
+		{
+			name: "cycle",
+			options: []Option{
+				opt("config", []string{"config"}, nil),
+				opt("a", []string{"a"}, []string{"config", "b"}),
+				opt("b", []string{"b"}, []string{"c"}),
+				opt("c", []string{"c"}, []string{"a"}),
+			},
+			err: "circular dependency: a -> b -> c -> a",
+		},
+		{
+			name: "self cycle",
+			options: []Option{
+				opt("a", []string{"a"}, []string{"a"}),
+			},
+			err: "circular dependency: a -> a",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			sorted, err := sortOptions(c.options)
+			if c.err != "" {
+				if err == nil || !strings.Contains(err.Error(), c.err) {
+					t.Fatalf("expect error %q, got %v", c.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			names := make([]string, 0, len(sorted))
+			for _, o := range sorted {
+				names = append(names, o.name)
+			}
+			if strings.Join(names, ",") != strings.Join(c.want, ",") {
+				t.Fatalf("got %v, want %v", names, c.want)
+			}
+		})
+	}
+}
+
+func TestHooksStartStop(t *testing.T) {
+	var calls []string
+	hook := func(name string, failStart bool) Hook {
+		return Hook{
+			Name: name,
+			OnStart: func(context.Context) error {
+				calls = append(calls, "start "+name)
+				if failStart {
+					return errors.New("failed")
+				}
+				return nil
+			},
+			OnStop: func(context.Context) error {
+				calls = append(calls, "stop "+name)
+				return nil
+			},
+		}
+	}
+
+	a := &app{}
+	a.appendHook(hook("redis", false))
+	a.appendHook(Hook{Name: "monitor", OnStop: func(context.Context) error {
+		calls = append(calls, "stop monitor")
+		return nil
+	}})
+	a.appendHook(hook("web", false))
+	if err := a.start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	_ = a.stop(context.Background())
+
+	want := "start redis,start web,stop web,stop monitor,stop redis"
+	if got := strings.Join(calls, ","); got != want {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+}
+
+func TestHooksStartRollback(t *testing.T) {
+	var calls []string
+	record := func(s string) func(context.Context) error {
+		return func(context.Context) error {
+			calls = append(calls, s)
+			return nil
+		}
+	}
+
+	a := &app{}
+	a.appendHook(Hook{Name: "a", OnStart: record("start a"), OnStop: record("stop a")})
+	a.appendHook(Hook{Name: "pool", OnStop: record("stop pool")})
+	a.appendHook(Hook{Name: "b", OnStart: record("start b"), OnStop: record("stop b")})
+	a.appendHook(Hook{Name: "c", OnStart: func(context.Context) error {
+		calls = append(calls, "start c")
+		return errors.New("port in use")
+	}, OnStop: record("stop c")})
+	a.appendHook(Hook{Name: "d", OnStart: record("start d"), OnStop: record("stop d")})
+
+	err := a.start(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "start c") {
+		t.Fatalf("expect start c error, got %v", err)
+	}
+
+	// 已经启动的钩子逆序回滚，没有 OnStart 的钩子留给 stop 释放
+	want := "start a,start b,start c,stop b,stop a"
+	if got := strings.Join(calls, ","); got != want {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+
+	// 调用方随后 Stop 时不重复停止已经回滚的钩子
+	calls = nil
+	_ = a.stop(context.Background())
+	want = "stop pool"
+	if got := strings.Join(calls, ","); got != want {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+}
@@ -1,10 +1,13 @@
 package app
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 	"net"
 	"net/http"
 	"os"
+	"path/filepath"
 	"runtime"
 	"strings"
 	"time"
@@ -14,7 +17,7 @@ import (
 	innerConfig "template/internal/config"
 	"template/internal/service"
 	"template/internal/store"
-	"template/pkg/infra/mongo"
+	"template/pkg/infra/kv"
 	"template/pkg/infra/monitoring"
 	"template/pkg/infra/mysql"
 	"template/pkg/infra/nid"
@@ -22,28 +25,20 @@ import (
 	"template/pkg/proto"
 
 	zlog "github.com/asim/go-micro/plugins/logger/zerolog/v3"
-	"github.com/asim/go-micro/plugins/registry/consul/v3"
 	"github.com/asim/go-micro/plugins/transport/grpc/v3"
 	microLimiter "github.com/asim/go-micro/plugins/wrapper/ratelimiter/ratelimit/v3"
 	"github.com/asim/go-micro/plugins/wrapper/trace/opencensus/v3"
 	"github.com/asim/go-micro/plugins/wrapper/validator/v3"
 	"github.com/asim/go-micro/v3"
-	"github.com/asim/go-micro/v3/config"
-	"github.com/asim/go-micro/v3/config/source/env"
-	"github.com/asim/go-micro/v3/config/source/flag"
 	"github.com/asim/go-micro/v3/logger"
-	"github.com/asim/go-micro/v3/registry"
 	"github.com/asim/go-micro/v3/server"
 	"github.com/asim/go-micro/v3/web"
-	"github.com/docker/libkv"
 	libKVStore "github.com/docker/libkv/store"
-	libKVConsul "github.com/docker/libkv/store/consul"
 	"github.com/felixge/fgprof"
 	"github.com/gin-contrib/cors"
 	"github.com/gin-contrib/gzip"
 	"github.com/gin-contrib/pprof"
 	"github.com/gin-gonic/gin"
-	"github.com/go-redis/redis/v8"
 	"github.com/imdario/mergo"
 	"github.com/juju/ratelimit"
 	"github.com/pkg/errors"
@@ -55,456 +50,601 @@ const (
 	timeFormat = "2006-01-02 15:04:05.000"
 )
 
-// Option ...
-type Option func(*app) error
-
-// Config ...
+// Config 加载 flag、env 和 -config 指定的本地配置文件
 func Config() Option {
-	return func(a *app) (err error) {
-		flagSource := flag.NewSource(
-			flag.IncludeUnset(true),
-		)
-
-		a.conf, err = config.NewConfig()
-		if err != nil {
-			return errors.Wrap(err, "Config()")
-		}
-
-		err = a.conf.Load(flagSource, env.NewSource())
-		if err != nil {
-			return err
-		}
-
-		return nil
+	return Option{
+		name:     "Config",
+		provides: []string{depConfig},
+		apply: func(a *app) (err error) {
+			a.conf, err = loadConfig(configFile())
+			if err != nil {
+				return errors.Wrap(err, "Config()")
+			}
+
+			return nil
+		},
 	}
 }
 
 // Version ...
 func Version(versionInfo string) Option {
-	return func(a *app) (err error) {
-		printVersion := a.conf.Get(printVersionKey).Bool(printVersionDef)
-		if printVersion {
-			_, _ = fmt.Fprintf(os.Stderr, "%v build info: %v\n", serverName,
-				strings.ReplaceAll(versionInfo, "_", "\n"))
-			os.Exit(0)
-		}
-
-		return nil
+	return Option{
+		name:     "Version",
+		requires: []string{depConfig},
+		apply: func(a *app) (err error) {
+			printVersion := a.conf.Get(printVersionKey).Bool(printVersionDef)
+			if printVersion {
+				_, _ = fmt.Fprintf(os.Stderr, "%v build info: %v\n", serverName,
+					strings.ReplaceAll(versionInfo, "_", "\n"))
+				os.Exit(0)
+			}
+
+			return nil
+		},
 	}
 }
 
 // NodeID ...
 func NodeID() Option {
-	return func(a *app) error {
-		ip, err := a.intranetIP()
-		if err != nil {
-			return err
-		}
-
-		addr := a.conf.Get(consulAddrKey).String(consulAddrDef)
-		nodeNamed, err := nid.NewConsulNamed(addr)
-		if err != nil {
-			return errors.Wrapf(err, "get consul addr: %s", consulAddrKey)
-		}
-
-		serviceKey := serverName
-		keyPrefix := a.conf.Get(consulPrefixKey).String(consulPrefixDef)
-		if keyPrefix != "" {
-			serviceKey = fmt.Sprintf("%v/%v", keyPrefix, serviceKey)
-		}
-
-		a.nodeID, err = nodeNamed.GetNodeID(&nid.NameHolder{
-			LocalPath:  os.Args[0],
-			LocalIP:    ip,
-			ServiceKey: serviceKey,
-		})
-
-		if err != nil {
-			return errors.Wrapf(err, "get consul nodeid: %s", serviceKey)
-		}
-
-		return nil
+	return Option{
+		name:     "NodeID",
+		provides: []string{depNodeID},
+		requires: []string{depConfig, depKVStore},
+		apply: func(a *app) error {
+			ip, err := a.intranetIP()
+			if err != nil {
+				return err
+			}
+
+			nodeNamed := nid.NewNamed(a.kvStore)
+
+			serviceKey := serverName
+			keyPrefix := a.conf.Get(consulPrefixKey).String(consulPrefixDef)
+			if keyPrefix != "" {
+				serviceKey = fmt.Sprintf("%v/%v", keyPrefix, serviceKey)
+			}
+
+			a.nodeID, err = nodeNamed.GetNodeID(&nid.NameHolder{
+				LocalPath:  os.Args[0],
+				LocalIP:    ip,
+				ServiceKey: serviceKey,
+			})
+
+			if err != nil {
+				return errors.Wrapf(err, "get nodeid: %s", serviceKey)
+			}
+
+			return nil
+		},
 	}
 }
 
 // Logger ...
 func Logger() Option {
-	return func(a *app) error {
-		lv := a.conf.Get(logLevelKey).String(logLevelDef)
-		level, err := zerolog.ParseLevel(lv)
-		if err != nil {
-			level = zerolog.DebugLevel
-		}
-
-		zerolog.TimestampFieldName = "ts"
-		zerolog.MessageFieldName = "msg"
-		zerolog.LevelFieldName = "lvl"
-		zerolog.TimeFieldFormat = timeFormat
-
-		simpleHook := zerolog.HookFunc(func(e *zerolog.Event, level zerolog.Level, msg string) {
-			if _, file, line, ok := runtime.Caller(4); ok {
-				// 取文件名
-				idx := strings.LastIndexByte(file, '/')
-				if idx == -1 {
-					e.Str("file", fmt.Sprintf("%s:%d", file, line))
-					return
-				}
+	return Option{
+		name:     "Logger",
+		provides: []string{depLogger},
+		requires: []string{depConfig, depNodeID},
+		apply: func(a *app) error {
+			lv := a.conf.Get(logLevelKey).String(logLevelDef)
+			level, err := zerolog.ParseLevel(lv)
+			if err != nil {
+				level = zerolog.DebugLevel
+			}
 
-				// 取包名
-				idx = strings.LastIndexByte(file[:idx], '/')
-				if idx == -1 {
-					e.Str("file", fmt.Sprintf("%s:%d", file[:idx], line))
-					return
+			zerolog.TimestampFieldName = "ts"
+			zerolog.MessageFieldName = "msg"
+			zerolog.LevelFieldName = "lvl"
+			zerolog.TimeFieldFormat = timeFormat
+
+			simpleHook := zerolog.HookFunc(func(e *zerolog.Event, level zerolog.Level, msg string) {
+				if _, file, line, ok := runtime.Caller(4); ok {
+					// 取文件名
+					idx := strings.LastIndexByte(file, '/')
+					if idx == -1 {
+						e.Str("file", fmt.Sprintf("%s:%d", file, line))
+						return
+					}
+
+					// 取包名
+					idx = strings.LastIndexByte(file[:idx], '/')
+					if idx == -1 {
+						e.Str("file", fmt.Sprintf("%s:%d", file[:idx], line))
+						return
+					}
+
+					// 返回包名和文件名
+					e.Str("file", fmt.Sprintf("%s:%d", file[idx+1:], line))
 				}
+			})
 
-				// 返回包名和文件名
-				e.Str("file", fmt.Sprintf("%s:%d", file[idx+1:], line))
-			}
-		})
-
-		ip, _ := a.intranetIP()
-		log.Logger = zerolog.New(os.Stdout).Level(level).Hook(simpleHook).With().Timestamp().
-			Fields(map[string]interface{}{"id": a.nodeID}).IPAddr("ip", net.ParseIP(ip)).Logger()
-		log.Info().Msg("Init logger successfully.")
-
-		loglevel, _ := logger.GetLevel(lv)
-		logger.DefaultLogger = zlog.NewLogger(
-			logger.WithOutput(os.Stdout),
-			logger.WithLevel(loglevel),
-			zlog.WithTimeFormat(timeFormat),
-			zlog.WithProductionMode(),
-			zlog.WithHooks([]zerolog.Hook{simpleHook}),
-			logger.WithFields(map[string]interface{}{"id": a.nodeID, "ip": ip}),
-		)
-		return nil
+			ip, _ := a.intranetIP()
+			log.Logger = zerolog.New(os.Stdout).Level(level).Hook(simpleHook).With().Timestamp().
+				Fields(map[string]interface{}{"id": a.nodeID}).IPAddr("ip", net.ParseIP(ip)).Logger()
+			log.Info().Msg("Init logger successfully.")
+
+			loglevel, _ := logger.GetLevel(lv)
+			logger.DefaultLogger = zlog.NewLogger(
+				logger.WithOutput(os.Stdout),
+				logger.WithLevel(loglevel),
+				zlog.WithTimeFormat(timeFormat),
+				zlog.WithProductionMode(),
+				zlog.WithHooks([]zerolog.Hook{simpleHook}),
+				logger.WithFields(map[string]interface{}{"id": a.nodeID, "ip": ip}),
+			)
+			return nil
+		},
 	}
 }
 
-// KVStore ...
+// KVStore 配置中心，支持 consul、etcd、boltdb 和本地目录
 func KVStore() Option {
-	return func(a *app) (err error) {
-		libKVConsul.Register()
-		addr := a.conf.Get(consulAddrKey).String(consulAddrDef)
-		a.kvStore, err = libkv.NewStore(libKVStore.CONSUL, []string{addr},
-			&libKVStore.Config{ConnectionTimeout: 10 * time.Second})
-		if err != nil {
-			return errors.Wrapf(err, "option KVStore %s", consulAddrKey)
-		}
-		return nil
+	return Option{
+		name:     "KVStore",
+		provides: []string{depKVStore},
+		requires: []string{depConfig},
+		apply: func(a *app) (err error) {
+			// standalone 模式默认使用本地目录，节点编号也在本地分配
+			backend := a.conf.Get(kvBackendKey).String("")
+			if backend == "" {
+				backend = kvBackendDef
+				if a.conf.Get(standaloneKey).Bool(standaloneDef) {
+					backend = string(kv.FILE)
+				}
+			}
+
+			addr := a.conf.Get(kvAddrKey).String(kvAddrDef)
+			if addr == "" {
+				switch libKVStore.Backend(backend) {
+				case libKVStore.CONSUL:
+					addr = a.conf.Get(consulAddrKey).String(consulAddrDef)
+				case libKVStore.ETCD:
+					addr = "127.0.0.1:2379"
+				case libKVStore.BOLTDB:
+					addr = fmt.Sprintf("%v.db", serverName)
+				case kv.FILE:
+					addr = filepath.Join(os.TempDir(), serverName)
+				}
+			}
+
+			a.kvStore, err = kv.NewStore(backend, strings.Split(addr, ","))
+			if err != nil {
+				return errors.Wrapf(err, "option KVStore %s", kvBackendKey)
+			}
+
+			a.appendHook(Hook{
+				Name: "KVStore",
+				OnStop: func(context.Context) error {
+					a.kvStore.Close()
+					return nil
+				},
+			})
+
+			return nil
+		},
 	}
 }
 
-// RedisCli ...
+// RedisCli 配置变更时重建连接
 func RedisCli() Option {
-	return func(a *app) error {
-		conf := &redisConf{}
-		err := a.getConsulConf("redis", conf, &redisConf{
-			Mode:     "standalone",
-			Addr:     "127.0.0.1:6379",
-			Password: "",
-		})
-		if err != nil {
-			return errors.Wrapf(err, "options RedisCli")
-		}
-
-		if conf.Mode == redisModeCluster {
-			a.redisCli = redis.NewClusterClient(&redis.ClusterOptions{
-				Addrs:        []string{conf.Addr},
-				MaxRedirects: 3,
-				Password:     conf.Password,
-				MaxRetries:   3,
-				PoolSize:     200,
-				MinIdleConns: 20,
-				MaxConnAge:   time.Hour,
-				IdleTimeout:  time.Minute,
-			})
-		} else {
-			a.redisCli = redis.NewClient(&redis.Options{
-				Addr:         conf.Addr,
-				Password:     conf.Password,
-				MaxRetries:   3,
-				PoolSize:     200,
-				MinIdleConns: 20,
-				MaxConnAge:   time.Hour,
-				IdleTimeout:  time.Minute,
+	return Option{
+		name:     "RedisCli",
+		provides: []string{depRedis},
+		requires: []string{depKVStore, depLogger, depMonitor},
+		apply: func(a *app) error {
+			conf := &redisConf{}
+			err := a.getConsulConf(redisConfKey, conf, &redisConf{
+				Mode:     "standalone",
+				Addr:     "127.0.0.1:6379",
+				Password: "",
 			})
-		}
+			if err != nil {
+				return errors.Wrapf(err, "options RedisCli")
+			}
 
-		if a.redisCli == nil {
-			return errors.Errorf("create redis client failed, %v", conf.Info())
-		}
+			a.redisCli, err = newRedisCli(conf)
+			if err != nil {
+				return errors.Wrapf(err, "%v", conf.Info())
+			}
+
+			a.redlockClis, err = newRedlockClis(conf)
+			if err != nil {
+				_ = a.redisCli.Close()
+				return errors.Wrapf(err, "%v", conf.Info())
+			}
+			a.redisConf = conf
+
+			a.appendHook(Hook{
+				Name: "RedisCli",
+				OnStop: func(context.Context) error {
+					a.Lock()
+					defer a.Unlock()
+					closeRedisClis(a.redlockClis)
+					return a.redisCli.Close()
+				},
+			})
 
-		log.Info().Msg("New Redis client successfully.")
-		return nil
+			monitoring.RegisterPoolStats(redisConfKey, redisPoolStats(a.redisCli, conf))
+			monitoring.RegisterPoolStats(redlockPoolKind, redlockPoolStats(a.redlockClis, conf))
+			log.Info().Msg("New Redis client successfully.")
+			return a.watchConsulConf(redisConfKey, ConfigHandler(a.reloadRedis))
+		},
 	}
 }
 
-// MySQLCli ...
+// MySQLCli 配置变更时重建连接
 func MySQLCli() Option {
-	return func(a *app) error {
-		conf := &mysqlConf{}
-		err := a.getConsulConf("mysql", conf, &mysqlConf{
-			Host:     "127.0.0.1",
-			Port:     3306,
-			User:     "root",
-			Password: "Admin123",
-			Database: "db_player",
-		})
-		if err != nil {
-			return errors.Wrap(err, "option MySQLCli")
-		}
-
-		a.mysqlCli, err = mysql.NewMysqlPoolWithTrace(&mysql.Config{
-			Host:     conf.Host,
-			Port:     conf.Port,
-			User:     conf.User,
-			Password: conf.Password,
-			DBName:   conf.Database,
-			CharSet:  "utf8mb4",
-			MaxConn:  200,
-			IdleConn: 10,
-		})
-
-		if err != nil {
-			return errors.Wrapf(err, "%v", conf.Info())
-		}
-
-		if a.mysqlCli == nil {
-			return errors.Errorf("create mysql client failed, %v", conf.Info())
-		}
-
-		log.Info().Msg("New MySQL client successfully.")
-		return nil
+	return Option{
+		name:     "MySQLCli",
+		provides: []string{depMySQL},
+		requires: []string{depKVStore, depLogger, depMonitor},
+		apply: func(a *app) error {
+			conf := &mysqlConf{}
+			err := a.getConsulConf(mysqlConfKey, conf, &mysqlConf{
+				Host:     "127.0.0.1",
+				Port:     3306,
+				User:     "root",
+				Password: "Admin123",
+				Database: "db_player",
+			})
+			if err != nil {
+				return errors.Wrap(err, "option MySQLCli")
+			}
+
+			a.mysqlCli, err = newMySQLCli(conf)
+			if err != nil {
+				return errors.Wrapf(err, "%v", conf.Info())
+			}
+
+			if a.mysqlCli == nil {
+				return errors.Errorf("create mysql client failed, %v", conf.Info())
+			}
+			a.mysqlConf = conf
+
+			if a.conf.Get(migrateKey).Bool(migrateDef) {
+				if err = migrate(a.mysqlCli); err != nil {
+					return errors.Wrap(err, "option MySQLCli")
+				}
+			}
+
+			a.appendHook(Hook{
+				Name: "MySQLCli",
+				OnStop: func(context.Context) error {
+					a.Lock()
+					defer a.Unlock()
+					return a.mysqlCli.Close()
+				},
+			})
+
+			monitoring.RegisterPoolStats(mysqlConfKey, a.mysqlCli.PoolStats)
+			log.Info().Msg("New MySQL client successfully.")
+			return a.watchConsulConf(mysqlConfKey, ConfigHandler(a.reloadMySQL))
+		},
 	}
 }
 
-// MongoCli ...
+// MongoCli 配置变更时重建连接
 func MongoCli() Option {
-	return func(a *app) (err error) {
-		conf := &mongodbConf{}
-		err = a.getConsulConf("mongodb", conf, &mongodbConf{
-			Host:       []string{"127.0.0.1:27017"},
-			User:       "",
-			Password:   "",
-			AuthSource: "admin",
-			Database:   "ffa",
-		})
-		if err != nil {
-			return errors.Wrap(err, "option MongoCli")
-		}
-
-		a.mongoCli, err = mongo.NewClient(&mongo.Config{
-			Hosts:       conf.Host,
-			Database:    conf.Database,
-			UserName:    conf.User,
-			Password:    conf.Password,
-			AuthSource:  conf.AuthSource,
-			MaxPoolSize: 200,
-			MinPoolSize: 10,
-			MaxIdleTime: 3600,
-		})
-
-		if err != nil {
-			return errors.Wrapf(err, "%v", conf.Info())
-		}
-
-		if a.mongoCli == nil {
-			err = errors.Errorf("create mongo client failed, %v", conf.Info())
-		}
-
-		log.Info().Msg("New Mongodb client successfully.")
-		return
+	return Option{
+		name:     "MongoCli",
+		provides: []string{depMongo},
+		requires: []string{depKVStore, depLogger, depMonitor},
+		apply: func(a *app) (err error) {
+			conf := &mongodbConf{}
+			err = a.getConsulConf(mongoConfKey, conf, &mongodbConf{
+				Host:       []string{"127.0.0.1:27017"},
+				User:       "",
+				Password:   "",
+				AuthSource: "admin",
+				Database:   "ffa",
+			})
+			if err != nil {
+				return errors.Wrap(err, "option MongoCli")
+			}
+
+			a.mongoCli, err = newMongoCli(conf)
+			if err != nil {
+				return errors.Wrapf(err, "%v", conf.Info())
+			}
+
+			if a.mongoCli == nil {
+				return errors.Errorf("create mongo client failed, %v", conf.Info())
+			}
+			a.mongoConf = conf
+
+			if a.conf.Get(syncIndexKey).Bool(syncIndexDef) {
+				if err = syncIndexes(a.mongoCli, a.conf.Get(dropIndexKey).Bool(dropIndexDef)); err != nil {
+					return errors.Wrap(err, "option MongoCli")
+				}
+			}
+
+			a.appendHook(Hook{
+				Name: "MongoCli",
+				OnStop: func(ctx context.Context) error {
+					a.Lock()
+					defer a.Unlock()
+					return a.mongoCli.Close(ctx)
+				},
+			})
+
+			monitoring.RegisterPoolStats(mongoConfKey, a.mongoCli.PoolStats)
+			log.Info().Msg("New Mongodb client successfully.")
+			return a.watchConsulConf(mongoConfKey, ConfigHandler(a.reloadMongo))
+		},
+	}
+}
+
+// ShardCli 分库分表，配置变更时复用没有变化的库的连接
+func ShardCli() Option {
+	return Option{
+		name:     "ShardCli",
+		provides: []string{depShard},
+		requires: []string{depKVStore, depLogger, depMonitor},
+		apply: func(a *app) (err error) {
+			conf := &mysql.ShardConfig{}
+			err = a.getConsulConf(shardConfKey, conf, &mysql.ShardConfig{
+				Nodes:  []mysql.Config{},
+				Tables: map[string]mysql.TableRule{},
+			})
+			if err != nil {
+				return errors.Wrap(err, "option ShardCli")
+			}
+
+			a.shardCli, err = mysql.NewShardClient(conf)
+			if err != nil {
+				return errors.Wrap(err, "option ShardCli")
+			}
+
+			a.appendHook(Hook{
+				Name: "ShardCli",
+				OnStop: func(context.Context) error {
+					return a.shardCli.Close()
+				},
+			})
+
+			monitoring.RegisterPoolStats(shardConfKey, a.shardCli.PoolStats)
+			log.Info().Int("nodes", len(conf.Nodes)).Msg("New shard client successfully.")
+			return a.watchConsulConf(shardConfKey, ConfigHandler(a.reloadShard))
+		},
 	}
 }
 
 // Dao ...
 func Dao() Option {
-	return func(a *app) (err error) {
-		a.dao = store.NewDao(a.redisCli, a.mysqlCli, a.mongoCli)
-		if a.dao == nil {
-			return errors.New("create dao failed")
-		}
-
-		log.Info().Msg("New dao successfully.")
-		return
+	return Option{
+		name:     "Dao",
+		provides: []string{depDao},
+		requires: []string{depRedis, depMySQL, depMongo, depShard},
+		apply: func(a *app) (err error) {
+			a.Lock()
+			a.dao = store.NewDao(a.redisCli, a.redlockClis, a.mysqlCli, a.mongoCli, a.shardCli)
+			a.Unlock()
+			if a.dao == nil {
+				return errors.New("create dao failed")
+			}
+
+			log.Info().Msg("New dao successfully.")
+			return
+		},
 	}
 }
 
 // UseCase ...
 func UseCase() Option {
-	return func(a *app) error {
-		conf := &innerConfig.BizConf{}
-		defConf := &innerConfig.BizConf{
-			ThirdParty: "http://httpbin.org",
-		}
-		err := a.getConsulConf(innerConfig.BizConfKey, conf, defConf)
-		if err != nil && err != libKVStore.ErrKeyNotFound {
-			return errors.Wrapf(err, "option UseCase get key %s", innerConfig.BizConfKey)
-		}
-
-		// 防止少配参数
-		if err = mergo.Merge(conf, defConf); err != nil {
-			return errors.Wrap(err, "option UseCase merge config")
-		}
-
-		a.useCase = service.NewUseCase(a.dao, conf)
-		a.watchConsulConfTree("test", conf)
-		return a.watchConsulConf(innerConfig.BizConfKey, conf)
+	return Option{
+		name:     "UseCase",
+		provides: []string{depUseCase},
+		requires: []string{depDao, depKVStore},
+		apply: func(a *app) error {
+			defBiz := &innerConfig.Biz{
+				ThirdParty: "http://httpbin.org",
+			}
+			conf, err := innerConfig.NewBizConf(defBiz, defBiz)
+			if err != nil {
+				return errors.Wrap(err, "option UseCase default config")
+			}
+
+			// 首次加载与热更新使用同一个解析过程，未知字段、缺少字段的处理保持一致
+			var raw json.RawMessage
+			err = a.getConsulConf(innerConfig.BizConfKey, &raw, defBiz)
+			if err != nil && err != libKVStore.ErrKeyNotFound {
+				return errors.Wrapf(err, "option UseCase get key %s", innerConfig.BizConfKey)
+			}
+
+			if len(raw) > 0 {
+				if err = conf.OnConfigChanged(innerConfig.BizConfKey, raw); err != nil {
+					return errors.Wrap(err, "option UseCase")
+				}
+			}
+
+			a.useCase = service.NewUseCase(a.dao, conf)
+			a.watchConsulConfTree("test", conf)
+			return a.watchConsulConf(innerConfig.BizConfKey, conf)
+		},
 	}
 }
 
 // RpcService ...
 func RpcService() Option {
-	return func(a *app) error {
-		conf := &rpcConf{}
-		err := a.getConsulConf("rpc", conf, &rpcConf{
-			RpcMode: "debug",
-			Port:    18086,
-		})
-		if err != nil {
-			return errors.Wrap(err, "option RpcService")
-		}
-
-		if conf.RpcMode == "test" {
-			conf.Port = conf.Port + uint16(a.nodeID-1)
-		}
-
-		consulAddr := a.conf.Get(consulAddrKey).String(consulAddrDef)
-		srvName := fmt.Sprintf("%vRPC", serverName)
-		serverID := fmt.Sprintf("%02v", a.nodeID)
-		a.rpcService = micro.NewService(
-			micro.Server(server.NewServer(
-				server.Name(srvName), // consul 中的 service name
-				server.Id(serverID),
-				server.Transport(grpc.NewTransport()),
-				server.Metadata(map[string]string{
-					"nodeId":      serverID,
-					"serviceName": srvName,
-					"type":        "rpc",
-				}),
-				server.Address(fmt.Sprintf(":%v", conf.Port)),
-				server.Registry(consul.NewRegistry(
-					registry.Addrs(consulAddr),
+	return Option{
+		name:     "RpcService",
+		provides: []string{depRpcSvc},
+		requires: []string{depUseCase, depNodeID},
+		apply: func(a *app) error {
+			conf := &rpcConf{}
+			err := a.getConsulConf("rpc", conf, &rpcConf{
+				RpcMode: "debug",
+				Port:    18086,
+			})
+			if err != nil {
+				return errors.Wrap(err, "option RpcService")
+			}
+
+			if conf.RpcMode == "test" {
+				conf.Port = conf.Port + uint16(a.nodeID-1)
+			}
+
+			srvName := fmt.Sprintf("%vRPC", serverName)
+			serverID := fmt.Sprintf("%02v", a.nodeID)
+			a.rpcService = micro.NewService(
+				micro.Context(a.ctx),
+				micro.HandleSignal(false),
+				micro.Server(server.NewServer(
+					server.Name(srvName), // consul 中的 service name
+					server.Id(serverID),
+					server.Transport(grpc.NewTransport()),
+					server.Metadata(map[string]string{
+						"nodeId":      serverID,
+						"serviceName": srvName,
+						"type":        "rpc",
+					}),
+					server.Address(fmt.Sprintf(":%v", conf.Port)),
+					server.Wait(nil), // 退出时等待处理中的请求
+					server.Registry(a.newRegistry()),
+					server.WrapHandler(monitoring.GoMicroHandlerWrapper()),
+					server.WrapHandler(validator.NewHandlerWrapper()),
+					server.WrapHandler(opencensus.NewHandlerWrapper()),
+					server.WrapHandler(microLimiter.NewHandlerWrapper(
+						ratelimit.NewBucketWithQuantum(time.Second, 10000, 10000), true),
+					),
 				)),
-				server.WrapHandler(monitoring.GoMicroHandlerWrapper()),
-				server.WrapHandler(validator.NewHandlerWrapper()),
-				server.WrapHandler(opencensus.NewHandlerWrapper()),
-				server.WrapHandler(microLimiter.NewHandlerWrapper(
-					ratelimit.NewBucketWithQuantum(time.Second, 10000, 10000), true),
-				),
-			)),
-		)
-
-		err = proto.RegisterGreeterHandler(a.rpcService.Server(), rpc.NewRpcHandler(a.useCase))
-		if err != nil {
-			return errors.Wrap(err, "option RpcService")
-		}
-
-		log.Info().Msg("New rpc service successfully.")
-		return nil
+			)
+
+			err = proto.RegisterGreeterHandler(a.rpcService.Server(), rpc.NewRpcHandler(a.useCase))
+			if err != nil {
+				return errors.Wrap(err, "option RpcService")
+			}
+
+			log.Info().Msg("New rpc service successfully.")
+			return nil
+		},
 	}
 }
 
 // WebService ...
 func WebService() Option {
-	return func(a *app) error {
-		conf := &webConf{}
-		err := a.getConsulConf("web", conf, &webConf{
-			GinMode: "debug",
-			Port:    8086,
-		})
-		if err != nil {
-			return errors.Wrap(err, "option WebService")
-		}
-
-		if conf.GinMode != gin.DebugMode {
-			gin.SetMode(conf.GinMode)
-		}
-
-		// 创建路由
-		var ginRouter *gin.Engine
-		ginMode := gin.Mode()
-		if ginMode != gin.DebugMode {
-			ginRouter = gin.New()
+	return Option{
+		name:     "WebService",
+		provides: []string{depWebSvc},
+		requires: []string{depUseCase, depNodeID},
+		apply: func(a *app) error {
+			conf := &webConf{}
+			err := a.getConsulConf("web", conf, &webConf{
+				GinMode: "debug",
+				Port:    8086,
+			})
+			if err != nil {
+				return errors.Wrap(err, "option WebService")
+			}
+
+			if conf.GinMode != gin.DebugMode {
+				gin.SetMode(conf.GinMode)
+			}
+
+			// 创建路由
+			var ginRouter *gin.Engine
+			ginMode := gin.Mode()
+			if ginMode != gin.DebugMode {
+				ginRouter = gin.New()
+				if ginMode == gin.TestMode {
+					ginRouter.Use(gin.Logger())
+				}
+				ginRouter.Use(gin.Recovery())
+			} else {
+				ginRouter = gin.Default()
+			}
+			ginRouter.Use(cors.Default(), middleware.NewRateLimiter(time.Second, 10000))
+			ginRouter.Use(gzip.Gzip(gzip.DefaultCompression))
+			ginRouter.Use(monitoring.GinHandler())
+			ginRouter.NoRoute(func(ctx *gin.Context) {
+				ctx.AbortWithStatus(http.StatusNotFound)
+			})
+
+			// 配置热更新状态
+			ginRouter.GET("/debug/config", func(ctx *gin.Context) {
+				ctx.JSON(http.StatusOK, a.reload.snapshot())
+			})
+
+			// analyze On-CPU as well as Off-CPU time
+			ginRouter.GET("/debug/fgprof", gin.WrapH(fgprof.Handler()))
+
+			// pprof
+			pprof.Register(ginRouter)
+
+			// 配置 swagger address
+			ip, err := a.intranetIP()
+			if err != nil {
+				return errors.Wrap(err, "option WebService")
+			}
+
+			// Test Mode 支持同机多进程部署
 			if ginMode == gin.TestMode {
-				ginRouter.Use(gin.Logger())
-			}
-			ginRouter.Use(gin.Recovery())
-		} else {
-			ginRouter = gin.Default()
-		}
-		ginRouter.Use(cors.Default(), middleware.NewRateLimiter(time.Second, 10000))
-		ginRouter.Use(gzip.Gzip(gzip.DefaultCompression))
-		ginRouter.Use(monitoring.GinHandler())
-		ginRouter.NoRoute(func(ctx *gin.Context) {
-			ctx.AbortWithStatus(http.StatusNotFound)
-		})
-
-		// analyze On-CPU as well as Off-CPU time
-		ginRouter.GET("/debug/fgprof", gin.WrapH(fgprof.Handler()))
-
-		// pprof
-		pprof.Register(ginRouter)
-
-		// 配置 swagger address
-		ip, err := a.intranetIP()
-		if err != nil {
-			return errors.Wrap(err, "option WebService")
-		}
-
-		// Test Mode 支持同机多进程部署
-		if ginMode == gin.TestMode {
-			conf.Port = conf.Port + uint16(a.nodeID-1)
-		}
-		swaggerAddr := fmt.Sprintf("%v:%v", ip, conf.Port)
-
-		// 构建 web handler
-		err = rest.NewRestHandler(a.useCase, swaggerAddr).RegisterHandler(ginRouter)
-		if err != nil {
-			return errors.Wrap(err, "option WebService")
-		}
-		// 注册服务
-		consulAddr := a.conf.Get(consulAddrKey).String(consulAddrDef)
-		webName := fmt.Sprintf("%vWEB", serverName)
-		webID := fmt.Sprintf("%v-%02v", webName, a.nodeID)
-		a.webService = web.NewService(
-			web.Name(webName),
-			web.Id(webID),
-			web.Metadata(map[string]string{
-				"nodeId":      webID,
-				"serviceName": webName,
-				"type":        "web",
-				"protocol":    "http",
-			}),
-			web.Registry(consul.NewRegistry(
-				registry.Addrs(consulAddr),
-			)),
-			web.Address(fmt.Sprintf(":%v", conf.Port)),
-			web.Handler(ginRouter),
-		)
-
-		log.Info().Msg("New web service successfully.")
-		return nil
+				conf.Port = conf.Port + uint16(a.nodeID-1)
+			}
+			swaggerAddr := fmt.Sprintf("%v:%v", ip, conf.Port)
+
+			// 构建 web handler
+			err = rest.NewRestHandler(a.useCase, swaggerAddr).RegisterHandler(ginRouter)
+			if err != nil {
+				return errors.Wrap(err, "option WebService")
+			}
+			// 注册服务
+			webName := fmt.Sprintf("%vWEB", serverName)
+			webID := fmt.Sprintf("%v-%02v", webName, a.nodeID)
+			a.httpServer = &http.Server{}
+			a.webService = web.NewService(
+				web.Context(a.ctx),
+				web.HandleSignal(false),
+				web.Server(a.httpServer),
+				web.Name(webName),
+				web.Id(webID),
+				web.Metadata(map[string]string{
+					"nodeId":      webID,
+					"serviceName": webName,
+					"type":        "web",
+					"protocol":    "http",
+				}),
+				web.Registry(a.newRegistry()),
+				web.Address(fmt.Sprintf(":%v", conf.Port)),
+				web.Handler(ginRouter),
+			)
+
+			// 等待处理中的 http 请求
+			a.appendHook(Hook{Name: "WebService", OnStop: a.httpServer.Shutdown})
+
+			log.Info().Msg("New web service successfully.")
+			return nil
+		},
 	}
 }
 
+// Monitor ...
 func Monitor() Option {
-	return func(a *app) error {
-		conf := &monitoring.Config{}
-		defaultCfg := &monitoring.Config{
-			Addr:       ":9100",
-			Path:       "/metrics",
-			ServerName: serverName,
-		}
-
-		err := a.getConsulConf("metrics", conf, defaultCfg)
-
-		if err != nil && err != libKVStore.ErrKeyNotFound {
-			return errors.Wrap(err, "option Monitor")
-		}
-
-		_ = mergo.Merge(conf, defaultCfg)
-		err = monitoring.Serve(conf)
-		return errors.Wrapf(err, "Monitor(): %s", "metrics")
+	return Option{
+		name:     "Monitor",
+		provides: []string{depMonitor},
+		requires: []string{depKVStore, depLogger},
+		apply: func(a *app) error {
+			conf := &monitoring.Config{}
+			defaultCfg := &monitoring.Config{
+				Addr:       ":9100",
+				Path:       "/metrics",
+				ServerName: serverName,
+			}
+
+			err := a.getConsulConf("metrics", conf, defaultCfg)
+
+			if err != nil && err != libKVStore.ErrKeyNotFound {
+				return errors.Wrap(err, "option Monitor")
+			}
+
+			_ = mergo.Merge(conf, defaultCfg)
+			if err = monitoring.Serve(conf); err != nil {
+				return errors.Wrapf(err, "Monitor(): %s", "metrics")
+			}
+
+			a.appendHook(Hook{Name: "Monitor", OnStop: monitoring.Shutdown})
+			return nil
+		},
 	}
 }
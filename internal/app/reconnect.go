@@ -0,0 +1,389 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"sync"
+	"time"
+
+	"template/internal/store"
+	"template/pkg/infra/mongo"
+	"template/pkg/infra/monitoring"
+	"template/pkg/infra/mysql"
+	infraredis "template/pkg/infra/redis"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	healthCheckTimeout = 5 * time.Second
+	redlockPoolKind    = "redlock"
+)
+
+// newRedisCli 按模式创建单机、集群或哨兵客户端
+func newRedisCli(conf *redisConf) (redis.UniversalClient, error) {
+	if err := conf.Validate(); err != nil {
+		return nil, err
+	}
+
+	tlsConfig, err := conf.TLS.config()
+	if err != nil {
+		return nil, err
+	}
+
+	opts := &redis.UniversalOptions{
+		Addrs:            conf.addrs(),
+		DB:               conf.DB,
+		Password:         conf.Password,
+		MasterName:       conf.MasterName,
+		SentinelPassword: conf.SentinelPassword,
+		MaxRedirects:     3,
+		MaxRetries:       intOr(conf.MaxRetries, 3),
+		PoolSize:         intOr(conf.PoolSize, 200),
+		MinIdleConns:     intOr(conf.MinIdleConns, 20),
+		DialTimeout:      conf.DialTimeout.or(5 * time.Second),
+		ReadTimeout:      conf.ReadTimeout.or(3 * time.Second),
+		WriteTimeout:     conf.WriteTimeout.or(3 * time.Second),
+		PoolTimeout:      conf.PoolTimeout.or(4 * time.Second),
+		MaxConnAge:       conf.MaxConnAge.or(time.Hour),
+		IdleTimeout:      conf.IdleTimeout.or(time.Minute),
+		TLSConfig:        tlsConfig,
+	}
+
+	slow := conf.SlowThreshold.or(100 * time.Millisecond)
+
+	// 不使用 NewUniversalClient，它按地址个数判断模式，单个种子节点的集群会被当作单机
+	switch conf.Mode {
+	case redisModeCluster:
+		// hook 装在每个节点上，指标按节点地址区分，集群 pipeline 也按节点拆分后经过节点的 hook
+		clusterOpts := opts.Cluster()
+		clusterOpts.NewClient = infraredis.NewClusterNodeClient(slow)
+		return redis.NewClusterClient(clusterOpts), nil
+	case redisModeSentinel:
+		cli := redis.NewFailoverClient(opts.Failover())
+		cli.AddHook(infraredis.NewHook(conf.MasterName, slow))
+		return cli, nil
+	default:
+		cli := redis.NewClient(opts.Simple())
+		cli.AddHook(infraredis.NewHook(cli.Options().Addr, slow))
+		return cli, nil
+	}
+}
+
+// newRedlockClis 任何一个节点创建失败时关闭已经创建的连接
+func newRedlockClis(conf *redisConf) ([]redis.UniversalClient, error) {
+	clis := make([]redis.UniversalClient, 0, len(conf.Redlock))
+	for i, node := range conf.Redlock {
+		cli, err := newRedisCli(node)
+		if err != nil {
+			closeRedisClis(clis)
+			return nil, errors.Wrapf(err, "redlock node %v", i)
+		}
+		clis = append(clis, cli)
+	}
+	return clis, nil
+}
+
+func closeRedisClis(clis []redis.UniversalClient) error {
+	var err error
+	for _, cli := range clis {
+		if e := cli.Close(); e != nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// redlockPoolStats 合并各个 redlock 节点的连接池
+func redlockPoolStats(clis []redis.UniversalClient, conf *redisConf) monitoring.PoolStatsFunc {
+	fns := make([]monitoring.PoolStatsFunc, 0, len(clis))
+	for i, cli := range clis {
+		fns = append(fns, redisPoolStats(cli, conf.Redlock[i]))
+	}
+
+	return func() map[string]monitoring.PoolStats {
+		result := make(map[string]monitoring.PoolStats)
+		for _, fn := range fns {
+			for instance, stats := range fn() {
+				result[instance] = stats
+			}
+		}
+		return result
+	}
+}
+
+// redisPoolStats 集群模式下统计每个节点的连接池
+func redisPoolStats(cli redis.UniversalClient, conf *redisConf) monitoring.PoolStatsFunc {
+	maxConns := uint32(intOr(conf.PoolSize, 200))
+	convert := func(stats *redis.PoolStats) monitoring.PoolStats {
+		return monitoring.PoolStats{
+			MaxConns:   maxConns,
+			TotalConns: stats.TotalConns,
+			IdleConns:  stats.IdleConns,
+			Timeouts:   uint64(stats.Timeouts),
+		}
+	}
+
+	return func() map[string]monitoring.PoolStats {
+		result := make(map[string]monitoring.PoolStats)
+		switch c := cli.(type) {
+		case *redis.ClusterClient:
+			var mu sync.Mutex
+			_ = c.ForEachShard(context.Background(), func(ctx context.Context, shard *redis.Client) error {
+				mu.Lock()
+				defer mu.Unlock()
+				result[shard.Options().Addr] = convert(shard.PoolStats())
+				return nil
+			})
+		case *redis.Client:
+			addr := c.Options().Addr
+			if conf.Mode == redisModeSentinel {
+				// 哨兵模式连接的是当前主节点，地址会变化
+				addr = conf.MasterName
+			}
+			result[addr] = convert(c.PoolStats())
+		}
+		return result
+	}
+}
+
+func newMySQLCli(conf *mysqlConf) (mysql.Client, error) {
+	return mysql.NewMysqlPoolWithTrace(&mysql.Config{
+		Host:          conf.Host,
+		Port:          conf.Port,
+		User:          conf.User,
+		Password:      conf.Password,
+		DBName:        conf.Database,
+		CharSet:       "utf8mb4",
+		MaxConn:       intOr(conf.MaxOpenConns, 200),
+		IdleConn:      intOr(conf.MaxIdleConns, 10),
+		IdleTimeout:   int(time.Duration(conf.IdleTimeout) / time.Second),
+		MaxLifetime:   int(time.Duration(conf.MaxLifetime) / time.Second),
+		DialTimeout:   conf.DialTimeout.or(5 * time.Second),
+		ReadTimeout:   time.Duration(conf.ReadTimeout),
+		WriteTimeout:  time.Duration(conf.WriteTimeout),
+		Replicas:      conf.Replicas,
+		SlowThreshold: int(conf.SlowThreshold.or(500*time.Millisecond) / time.Millisecond),
+	})
+}
+
+// migrate 启动时执行表结构迁移，多个节点同时启动时只有一个节点执行
+func migrate(cli mysql.Client) error {
+	db, ok := cli.GetOriginalSource().(*sqlx.DB)
+	if !ok {
+		return errors.Errorf("unexpected mysql source %T", cli.GetOriginalSource())
+	}
+
+	migrator, err := store.NewMigrator(db)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	done, err := migrator.Up(ctx)
+	for _, mig := range done {
+		log.Info().Int64("version", mig.Version).Str("name", mig.Name).Msg("mysql migration applied")
+	}
+	return errors.Wrap(err, "migrate")
+}
+
+// syncIndexes 启动时创建缺少的索引，多余和不一致的索引只有 drop 为 true 时才处理
+func syncIndexes(cli mongo.Client, drop bool) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	report, err := store.SyncIndexes(ctx, cli, mongo.SyncIndexOptions{Create: true, Drop: drop})
+	if report != nil {
+		log.Info().Strs("created", report.Created).Strs("dropped", report.Dropped).Msg("mongodb indexes synced")
+		if len(report.Extra)+len(report.Mismatched) > 0 && !drop {
+			log.Warn().Strs("extra", report.Extra).Strs("mismatched", report.Mismatched).
+				Msg("mongodb indexes differ from declaration")
+		}
+	}
+	return errors.Wrap(err, "sync indexes")
+}
+
+func newMongoCli(conf *mongodbConf) (mongo.Client, error) {
+	return mongo.NewClient(&mongo.Config{
+		Hosts:          conf.Host,
+		Database:       conf.Database,
+		UserName:       conf.User,
+		Password:       conf.Password,
+		AuthSource:     conf.AuthSource,
+		MaxPoolSize:    uint(intOr(conf.MaxPoolSize, 200)),
+		MinPoolSize:    uint(intOr(conf.MinPoolSize, 10)),
+		MaxIdleTime:    uint(conf.MaxIdleTime.or(time.Hour) / time.Second),
+		ConnectTimeout: time.Duration(conf.ConnectTimeout),
+		SocketTimeout:  time.Duration(conf.SocketTimeout),
+	})
+}
+
+// reloadRedis 新连接可用后才替换，否则保留旧连接
+func (a *app) reloadRedis(key string, data []byte) error {
+	conf := &redisConf{}
+	if err := json.Unmarshal(data, conf); err != nil {
+		return errors.Wrapf(err, "decode '%v'", key)
+	}
+
+	a.Lock()
+	same := reflect.DeepEqual(conf, a.redisConf)
+	a.Unlock()
+	if same {
+		return nil
+	}
+
+	cli, err := newRedisCli(conf)
+	if err != nil {
+		return errors.Wrapf(err, "create redis client %v", conf.Info())
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), healthCheckTimeout)
+	defer cancel()
+
+	if err = cli.Ping(ctx).Err(); err != nil {
+		_ = cli.Close()
+		return errors.Wrapf(err, "ping redis %v", conf.Info())
+	}
+
+	// redlock 允许少数节点不可用，不做 ping
+	redlockClis, err := newRedlockClis(conf)
+	if err != nil {
+		_ = cli.Close()
+		return errors.Wrapf(err, "create redis client %v", conf.Info())
+	}
+
+	a.Lock()
+	old, oldRedlock := a.redisCli, a.redlockClis
+	a.redisCli, a.redlockClis, a.redisConf = cli, redlockClis, conf
+	if swapper, ok := a.dao.(store.Swapper); ok {
+		swapper.SwapRedis(cli)
+		swapper.SwapRedlock(redlockClis)
+	}
+	a.Unlock()
+	monitoring.RegisterPoolStats(redisConfKey, redisPoolStats(cli, conf))
+	monitoring.RegisterPoolStats(redlockPoolKind, redlockPoolStats(redlockClis, conf))
+
+	a.closeLater(key, func(context.Context) error {
+		closeRedisClis(oldRedlock)
+		return old.Close()
+	})
+	return nil
+}
+
+// reloadMySQL 新连接可用后才替换，否则保留旧连接
+func (a *app) reloadMySQL(key string, data []byte) error {
+	conf := &mysqlConf{}
+	if err := json.Unmarshal(data, conf); err != nil {
+		return errors.Wrapf(err, "decode '%v'", key)
+	}
+
+	a.Lock()
+	same := reflect.DeepEqual(conf, a.mysqlConf)
+	a.Unlock()
+	if same {
+		return nil
+	}
+
+	// 创建时会 ping
+	cli, err := newMySQLCli(conf)
+	if err != nil {
+		return errors.Wrapf(err, "connect mysql %v", conf.Info())
+	}
+
+	a.Lock()
+	old := a.mysqlCli
+	a.mysqlCli, a.mysqlConf = cli, conf
+	if swapper, ok := a.dao.(store.Swapper); ok {
+		swapper.SwapMySQL(cli)
+	}
+	a.Unlock()
+	monitoring.RegisterPoolStats(mysqlConfKey, cli.PoolStats)
+
+	a.closeLater(key, func(context.Context) error {
+		return old.Close()
+	})
+	return nil
+}
+
+// reloadMongo 新连接可用后才替换，否则保留旧连接
+func (a *app) reloadMongo(key string, data []byte) error {
+	conf := &mongodbConf{}
+	if err := json.Unmarshal(data, conf); err != nil {
+		return errors.Wrapf(err, "decode '%v'", key)
+	}
+
+	a.Lock()
+	same := reflect.DeepEqual(conf, a.mongoConf)
+	a.Unlock()
+	if same {
+		return nil
+	}
+
+	// 创建时会 ping
+	cli, err := newMongoCli(conf)
+	if err != nil {
+		return errors.Wrapf(err, "connect mongodb %v", conf.Info())
+	}
+
+	a.Lock()
+	old := a.mongoCli
+	a.mongoCli, a.mongoConf = cli, conf
+	if swapper, ok := a.dao.(store.Swapper); ok {
+		swapper.SwapMongo(cli)
+	}
+	a.Unlock()
+	monitoring.RegisterPoolStats(mongoConfKey, cli.PoolStats)
+
+	a.closeLater(key, old.Close)
+	return nil
+}
+
+// reloadShard 新配置的库都连接成功后才替换，不再使用的库延迟关闭
+func (a *app) reloadShard(key string, data []byte) error {
+	conf := &mysql.ShardConfig{}
+	if err := json.Unmarshal(data, conf); err != nil {
+		return errors.Wrapf(err, "decode '%v'", key)
+	}
+
+	stale, err := a.shardCli.Reload(conf)
+	if err != nil {
+		return err
+	}
+
+	for _, cli := range stale {
+		cli := cli
+		a.closeLater(key, func(context.Context) error {
+			return cli.Close()
+		})
+	}
+	return nil
+}
+
+// closeLater 等待旧连接上处理中的请求结束后再关闭，程序退出时立即关闭
+func (a *app) closeLater(key string, fn func(ctx context.Context) error) {
+	drain := time.Duration(a.conf.Get(shutdownTimeoutKey).Int(shutdownTimeoutDef)) * time.Second
+	go func() {
+		timer := time.NewTimer(drain)
+		defer timer.Stop()
+
+		select {
+		case <-timer.C:
+		case <-a.ctx.Done():
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), drain)
+		defer cancel()
+
+		if err := fn(ctx); err != nil {
+			log.Err(err).Str("key", key).Msg("close old client")
+			return
+		}
+		log.Info().Str("key", key).Msg("close old client")
+	}()
+}
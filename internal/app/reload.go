@@ -0,0 +1,76 @@
+package app
+
+import (
+	"sync"
+	"time"
+
+	"template/pkg/infra/monitoring"
+
+	libKVStore "github.com/docker/libkv/store"
+	"github.com/rs/zerolog/log"
+)
+
+// reloadStatus 记录每个 key 最后一次生效和被拒绝的配置版本
+type reloadStatus struct {
+	sync.RWMutex
+	keys map[string]*keyStatus
+}
+
+type keyStatus struct {
+	Version   uint64          `json:"version"`
+	AppliedAt string          `json:"appliedAt,omitempty"`
+	Rejected  *rejectedUpdate `json:"rejected,omitempty"`
+}
+
+type rejectedUpdate struct {
+	Version    uint64 `json:"version"`
+	Error      string `json:"error"`
+	RejectedAt string `json:"rejectedAt"`
+}
+
+// apply 交给 observer 校验并生效，失败时保留原配置并记录原因
+func (r *reloadStatus) apply(key string, pair *libKVStore.KVPair, observer ConfigObserver) {
+	err := observer.OnConfigChanged(key, pair.Value)
+	monitoring.RecordConfigReload(key, pair.LastIndex, err)
+
+	r.Lock()
+	defer r.Unlock()
+
+	if r.keys == nil {
+		r.keys = make(map[string]*keyStatus)
+	}
+
+	status, ok := r.keys[key]
+	if !ok {
+		status = &keyStatus{}
+		r.keys[key] = status
+	}
+
+	now := time.Now().Format(timeFormat)
+	if err != nil {
+		// 不记录配置内容，其中可能有密码
+		status.Rejected = &rejectedUpdate{
+			Version:    pair.LastIndex,
+			Error:      err.Error(),
+			RejectedAt: now,
+		}
+		log.Err(err).Str("key", pair.Key).Uint64("version", pair.LastIndex).Msg("reject config update")
+		return
+	}
+
+	status.Version = pair.LastIndex
+	status.AppliedAt = now
+	log.Info().Str("key", pair.Key).Uint64("version", pair.LastIndex).Msg("apply config update")
+}
+
+func (r *reloadStatus) snapshot() map[string]keyStatus {
+	r.RLock()
+	defer r.RUnlock()
+
+	result := make(map[string]keyStatus, len(r.keys))
+	for key, status := range r.keys {
+		result[key] = *status
+	}
+
+	return result
+}
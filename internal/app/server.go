@@ -6,19 +6,24 @@ import (
 	"flag"
 	"fmt"
 	"net"
+	"net/http"
 	"os"
 	"strings"
+	"sync"
 	"syscall"
+	"time"
 
 	"github.com/rs/zerolog/log"
 
 	"template/internal/service"
 	"template/internal/store"
+	"template/pkg/infra/discovery"
 	"template/pkg/infra/mongo"
 	"template/pkg/infra/mysql"
 
 	"github.com/asim/go-micro/v3"
 	"github.com/asim/go-micro/v3/config"
+	"github.com/asim/go-micro/v3/registry"
 	"github.com/asim/go-micro/v3/web"
 	libKVStore "github.com/docker/libkv/store"
 	"github.com/go-redis/redis/v8"
@@ -39,18 +44,48 @@ const (
 	printVersionKey = "version"
 	printVersionDef = false
 
+	standaloneKey = "standalone"
+	standaloneDef = false
+
+	kvBackendKey = "kv"
+	kvBackendDef = "consul"
+
+	kvAddrKey = "kvaddr"
+	kvAddrDef = ""
+
 	consulPrefixKey = "prefix"
 	consulPrefixDef = ""
+
+	configFileKey = "config"
+	configFileDef = ""
+
+	shutdownTimeoutKey = "shutdown"
+	shutdownTimeoutDef = 15 // second
+
+	migrateKey = "migrate"
+	migrateDef = false
+
+	syncIndexKey = "index"
+	syncIndexDef = true
+
+	dropIndexKey = "dropindex"
+	dropIndexDef = false
 )
 
 func init() {
 	// NOTE: go-micro 只支持小写字母的选项
 	flag.String(consulAddrKey, consulAddrDef, "the consul address")
 	flag.String(logLevelKey, logLevelDef, "log level")
+	flag.Bool(standaloneKey, standaloneDef, "run without consul: mdns registry, local kv store and node id")
+	flag.String(kvBackendKey, "", "config store backend: consul(default), etcd, boltdb, file(default in standalone mode)")
+	flag.String(kvAddrKey, kvAddrDef, "config store address, comma separated; bolt file or directory for boltdb/file")
 	flag.String(consulPrefixKey, consulPrefixDef, "consul key prefix")
 	flag.Bool(printVersionKey, printVersionDef, "print program build version")
-
-	flag.Parse()
+	flag.String(configFileKey, configFileDef, "local config file, json/yaml/toml")
+	flag.Int(shutdownTimeoutKey, shutdownTimeoutDef, "graceful shutdown timeout in seconds")
+	flag.Bool(migrateKey, migrateDef, "run mysql schema migrations on startup")
+	flag.Bool(syncIndexKey, syncIndexDef, "create missing mongodb indexes on startup")
+	flag.Bool(dropIndexKey, dropIndexDef, "drop extra mongodb indexes and rebuild mismatched ones on startup")
 }
 
 // App ...
@@ -59,11 +94,23 @@ type App interface {
 	Stop() error
 }
 
-// New ...
+// New 按依赖关系初始化各个组件
 func New(options ...Option) (App, error) {
-	svc := &app{ctx: context.Background()}
-	for _, opt := range options {
-		if err := opt(svc); err != nil {
+	// 不在 init 中解析，测试的 flag 在 init 之后才注册
+	if !flag.Parsed() {
+		flag.Parse()
+	}
+
+	sorted, err := sortOptions(options)
+	if err != nil {
+		return nil, errors.Wrap(err, "app.New")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	svc := &app{ctx: ctx, cancel: cancel, done: make(chan struct{})}
+	for _, opt := range sorted {
+		if err = opt.apply(svc); err != nil {
+			_ = svc.stop(context.Background())
 			return nil, err
 		}
 	}
@@ -72,26 +119,41 @@ func New(options ...Option) (App, error) {
 }
 
 type app struct {
-	nodeID     int
-	rpcService micro.Service
-	webService web.Service
-	useCase    service.UseCase
-	conf       config.Config
-	redisCli   redis.UniversalClient
-	mysqlCli   mysql.Client
-	mongoCli   mongo.Client
-	dao        store.Dao
-	kvStore    libKVStore.Store
-	ctx        context.Context
+	sync.Mutex  // 保护运行时替换的连接
+	nodeID      int
+	rpcService  micro.Service
+	webService  web.Service
+	httpServer  *http.Server
+	useCase     service.UseCase
+	conf        config.Config
+	redisCli    redis.UniversalClient
+	redlockClis []redis.UniversalClient
+	mysqlCli    mysql.Client
+	mongoCli    mongo.Client
+	shardCli    mysql.ShardClient
+	redisConf   *redisConf
+	mysqlConf   *mysqlConf
+	mongoConf   *mongodbConf
+	dao         store.Dao
+	kvStore     libKVStore.Store
+	ctx         context.Context
+	cancel      context.CancelFunc
+	done        chan struct{}
+	hooks       []Hook
+	reload      reloadStatus
 }
 
-// Run ...
+// Run 启动 rpc 和 web 服务，不阻塞；服务异常退出时通过 ch 通知调用方
 func (a *app) Run(ch chan<- os.Signal) error {
-
 	if err := agent.Listen(agent.Options{
-		ConfigDir:       os.TempDir(),
-		ShutdownCleanup: true,
+		ConfigDir: os.TempDir(),
 	}); err != nil {
+		close(a.done)
+		return err
+	}
+
+	if err := a.start(a.ctx); err != nil {
+		close(a.done)
 		return err
 	}
 
@@ -119,16 +181,36 @@ func (a *app) Run(ch chan<- os.Signal) error {
 		return nil
 	})
 
-	if err := g.Wait(); err != nil {
-		ch <- syscall.SIGQUIT
-		return err
-	}
+	go func() {
+		defer close(a.done)
+		if err := g.Wait(); err != nil {
+			log.Err(err).Msg("service exited")
+			ch <- syscall.SIGQUIT
+		}
+	}()
+
 	return nil
 }
 
-// Stop ...
+// Stop 优雅退出：先从 consul 注销并停止接收新请求，再按初始化顺序的逆序执行 OnStop 钩子，
+// 等待处理中的请求并释放资源
 func (a *app) Stop() error {
-	return nil
+	timeout := a.conf.Get(shutdownTimeoutKey).Int(shutdownTimeoutDef)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(timeout)*time.Second)
+	defer cancel()
+
+	// 注销服务并关闭监听，rpc 服务会等待处理中的请求
+	a.cancel()
+	select {
+	case <-a.done:
+	case <-ctx.Done():
+		log.Warn().Msg("wait for services to stop timeout")
+	}
+
+	err := a.stop(ctx)
+	agent.Close()
+	log.Info().Msg("Server stopped.")
+	return err
 }
 
 func (a *app) intranetIP() (string, error) {
@@ -148,6 +230,13 @@ func (a *app) intranetIP() (string, error) {
 	return "", errors.New("valid local IP not found")
 }
 
+// newRegistry standalone 模式使用 mdns 注册服务
+func (a *app) newRegistry() registry.Registry {
+	standalone := a.conf.Get(standaloneKey).Bool(standaloneDef)
+	consulAddr := a.conf.Get(consulAddrKey).String(consulAddrDef)
+	return discovery.NewRegistry(standalone, consulAddr)
+}
+
 func (a *app) makeConsulKey(key string) string {
 	keyPrefix := a.conf.Get(consulPrefixKey).String(consulPrefixDef)
 	if keyPrefix == "" {
@@ -156,24 +245,32 @@ func (a *app) makeConsulKey(key string) string {
 	return fmt.Sprintf("%v/%v/%v", keyPrefix, serverName, key)
 }
 
+// getConsulConf 读取配置，优先级 flag > env > file > consul > 默认值
 func (a *app) getConsulConf(key string, data interface{}, def interface{}) error {
+	hasLocal := a.hasLocalConf(key)
+	defValue, err := json.MarshalIndent(def, "", "\t")
+	if err != nil {
+		return err
+	}
+
 	consulKey := a.makeConsulKey(key)
 	kvPair, err := a.kvStore.Get(consulKey)
-	if err != nil {
+	switch {
+	case err == nil:
+	case hasLocal:
+		// 本地已经配置，consul 不可用或没有该 key 时不影响启动
 		if err != libKVStore.ErrKeyNotFound {
-			return err
+			log.Warn().Err(err).Str("key", consulKey).Msg("get consul conf, use local config")
 		}
-
+		kvPair = &libKVStore.KVPair{Key: consulKey, Value: defValue}
+	case err == libKVStore.ErrKeyNotFound:
 		// first startup
-		value, err := json.MarshalIndent(def, "", "\t")
-		if err != nil {
-			return err
-		}
-
-		_, kvPair, err = a.kvStore.AtomicPut(consulKey, value, nil, &libKVStore.WriteOptions{IsDir: false})
+		_, kvPair, err = a.kvStore.AtomicPut(consulKey, defValue, nil, &libKVStore.WriteOptions{IsDir: false})
 		if err != nil {
 			return err
 		}
+	default:
+		return err
 	}
 
 	err = json.Unmarshal(kvPair.Value, data)
@@ -181,10 +278,19 @@ func (a *app) getConsulConf(key string, data interface{}, def interface{}) error
 		return err
 	}
 
+	if hasLocal {
+		return a.conf.Get(key).Scan(data)
+	}
+
 	return nil
 }
 
 func (a *app) watchConsulConf(key string, observer ConfigObserver) error {
+	if a.hasLocalConf(key) {
+		log.Info().Str("key", key).Msg("local config takes precedence, skip watching consul")
+		return nil
+	}
+
 	kvChan, err := a.kvStore.Watch(a.makeConsulKey(key), make(chan struct{}, 1))
 	if err != nil {
 		return err
@@ -192,9 +298,7 @@ func (a *app) watchConsulConf(key string, observer ConfigObserver) error {
 
 	go func() {
 		for kv := range kvChan {
-			if err = observer.OnConfigChanged(key, kv.Value); err != nil {
-				log.Err(err).Str("key", key).Str("value", string(kv.Value)).Msg("watch consul key")
-			}
+			a.reload.apply(key, kv, observer)
 		}
 	}()
 
@@ -214,9 +318,7 @@ func (a *app) watchConsulConfTree(root string, observer ConfigObserver) error {
 					continue
 				}
 				idx := strings.LastIndex(pair.Key, root) + len(root)
-				if err = observer.OnConfigChanged(strings.TrimPrefix(pair.Key[idx:], "/"), pair.Value); err != nil {
-					log.Err(err).Str("key", pair.Key).Str("value", string(pair.Value)).Msg("watch consul dir")
-				}
+				a.reload.apply(strings.TrimPrefix(pair.Key[idx:], "/"), pair, observer)
 			}
 		}
 	}()
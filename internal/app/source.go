@@ -0,0 +1,94 @@
+package app
+
+import (
+	"bytes"
+	stdflag "flag"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/asim/go-micro/plugins/config/encoder/yaml/v3"
+	"github.com/asim/go-micro/v3/config"
+	"github.com/asim/go-micro/v3/config/encoder"
+	"github.com/asim/go-micro/v3/config/reader"
+	"github.com/asim/go-micro/v3/config/reader/json"
+	"github.com/asim/go-micro/v3/config/source"
+	"github.com/asim/go-micro/v3/config/source/env"
+	"github.com/asim/go-micro/v3/config/source/file"
+	"github.com/asim/go-micro/v3/config/source/flag"
+)
+
+// envPrefix 环境变量前缀，SVR_MYSQL_HOST 对应 mysql.host
+var envPrefix = strings.ToUpper(serverName) + "_"
+
+// newConfigReader 支持 json、yaml(yml)、toml 格式的配置文件
+func newConfigReader() reader.Reader {
+	return json.NewReader(
+		reader.WithEncoder(yaml.NewEncoder()),
+		reader.WithEncoder(aliasEncoder{Encoder: yaml.NewEncoder(), name: "yml"}),
+		reader.WithEncoder(tomlEncoder{}),
+	)
+}
+
+// loadConfig 后加载的优先级更高：flag > env > file；
+// 环境变量只读取 SVR_ 前缀的，避免 k8s 注入的 MYSQL_PORT=tcp://... 之类的变量覆盖配置
+func loadConfig(path string) (config.Config, error) {
+	conf, err := config.NewConfig(config.WithReader(newConfigReader()))
+	if err != nil {
+		return nil, err
+	}
+
+	sources := make([]source.Source, 0, 3)
+	if path != "" {
+		sources = append(sources, file.NewSource(file.WithPath(path)))
+	}
+	sources = append(sources, env.NewSource(env.WithStrippedPrefix(envPrefix)), flag.NewSource())
+
+	if err = conf.Load(sources...); err != nil {
+		return nil, err
+	}
+	return conf, nil
+}
+
+// configFile 返回 -config 指定的配置文件路径，配置文件需要在加载其他配置之前确定
+func configFile() string {
+	f := stdflag.Lookup(configFileKey)
+	if f == nil {
+		return ""
+	}
+
+	return strings.TrimSpace(f.Value.String())
+}
+
+type aliasEncoder struct {
+	encoder.Encoder
+	name string
+}
+
+func (e aliasEncoder) String() string {
+	return e.name
+}
+
+type tomlEncoder struct{}
+
+func (tomlEncoder) Encode(v interface{}) ([]byte, error) {
+	buf := bytes.NewBuffer(nil)
+	if err := toml.NewEncoder(buf).Encode(v); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func (tomlEncoder) Decode(d []byte, v interface{}) error {
+	return toml.Unmarshal(d, v)
+}
+
+func (tomlEncoder) String() string {
+	return "toml"
+}
+
+// hasLocalConf flag、带前缀的 env、配置文件中是否配置了 key
+func (a *app) hasLocalConf(key string) bool {
+	raw := bytes.TrimSpace(a.conf.Get(key).Bytes())
+	return len(raw) != 0 && !bytes.Equal(raw, []byte("null"))
+}
@@ -0,0 +1,65 @@
+package app
+
+import (
+	stdflag "flag"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"template/pkg/infra/kv"
+)
+
+func TestConfigPrecedence(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "svr.json")
+	err := os.WriteFile(path, []byte(`{
+		"loglevel": "debug",
+		"mysql": {"host": "file", "user": "file", "database": "file"}
+	}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// k8s 注入的同名变量不影响配置
+	t.Setenv("MYSQL_PORT", "tcp://10.0.0.3:3306")
+	t.Setenv("MYSQL_HOST", "k8s")
+	t.Setenv("SVR_LOGLEVEL", "warn")
+	t.Setenv("SVR_MYSQL_USER", "env")
+
+	if err = stdflag.Set(logLevelKey, "error"); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = stdflag.Set(logLevelKey, logLevelDef) }()
+
+	conf, err := loadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// flag > env > file
+	if level := conf.Get(logLevelKey).String(""); level != "error" {
+		t.Fatalf("expect loglevel from flag, got %v", level)
+	}
+
+	store, err := kv.NewFileStore([]string{filepath.Join(dir, "kv")}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a := &app{conf: conf, kvStore: store}
+	err = store.Put(a.makeConsulKey(mysqlConfKey),
+		[]byte(`{"host":"consul","port":3307,"user":"consul","password":"consul","database":"consul"}`), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// env > file > consul，本地没有配置的字段使用 consul 的值
+	mysql := &mysqlConf{}
+	if err = a.getConsulConf(mysqlConfKey, mysql, &mysqlConf{}); err != nil {
+		t.Fatal(err)
+	}
+	if mysql.Host != "file" || mysql.User != "env" || mysql.Port != 3307 ||
+		mysql.Password != "consul" || mysql.Database != "file" {
+		t.Fatalf("unexpected mysql config %+v", mysql)
+	}
+}
@@ -5,7 +5,6 @@ import (
 	"fmt"
 
 	"github.com/asim/go-micro/plugins/client/http/v3"
-	"github.com/asim/go-micro/plugins/registry/consul/v3"
 	"github.com/asim/go-micro/plugins/wrapper/breaker/hystrix/v3"
 	"github.com/asim/go-micro/plugins/wrapper/trace/opencensus/v3"
 	microClient "github.com/asim/go-micro/v3/client"
@@ -26,11 +25,7 @@ type Client interface {
 	Hello(ctx context.Context, rsp interface{}) error
 }
 
-func NewClient(consulAddr string) (Client, error) {
-	reg := consul.NewRegistry(
-		registry.Addrs(consulAddr),
-	)
-
+func NewClient(reg registry.Registry) (Client, error) {
 	sel := selector.NewSelector(
 		selector.Registry(reg),
 	)
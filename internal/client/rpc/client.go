@@ -5,7 +5,6 @@ import (
 
 	"template/pkg/proto"
 
-	"github.com/asim/go-micro/plugins/registry/consul/v3"
 	"github.com/asim/go-micro/plugins/transport/grpc/v3"
 	"github.com/asim/go-micro/plugins/wrapper/breaker/hystrix/v3"
 	"github.com/asim/go-micro/plugins/wrapper/trace/opencensus/v3"
@@ -22,11 +21,7 @@ type GreeterClient interface {
 	proto.GreeterService
 }
 
-func NewGreeterClient(consulAddr string) GreeterClient {
-	reg := consul.NewRegistry(
-		registry.Addrs(consulAddr),
-	)
-
+func NewGreeterClient(reg registry.Registry) GreeterClient {
 	sel := selector.NewSelector(
 		selector.Registry(reg),
 		selector.SetStrategy(selector.RoundRobin),
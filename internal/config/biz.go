@@ -1,8 +1,10 @@
 package config
 
 import (
+	"bytes"
 	"encoding/json"
-	"sync"
+	"net/url"
+	"sync/atomic"
 
 	"github.com/pkg/errors"
 )
@@ -11,30 +13,69 @@ const (
 	BizConfKey = "biz"
 )
 
-type BizConf struct {
-	sync.RWMutex
+// Biz 业务配置，热更新时整体替换，不要修改已经发布的实例
+type Biz struct {
 	ThirdParty string `json:"thirdParty"`
 }
 
-func (biz *BizConf) OnConfigChanged(key string, data []byte) error {
-	biz.Lock()
-	defer biz.Unlock()
+// Validate 校验配置
+func (b *Biz) Validate() error {
+	u, err := url.Parse(b.ThirdParty)
+	if err != nil {
+		return errors.Wrap(err, "thirdParty")
+	}
+
+	if u.Scheme != "http" && u.Scheme != "https" || u.Host == "" {
+		return errors.Errorf("thirdParty '%v' is not a http(s) url", b.ThirdParty)
+	}
+
+	return nil
+}
+
+// NewBizConf def 为默认配置，更新时缺少的字段使用默认值
+func NewBizConf(biz *Biz, def *Biz) (*BizConf, error) {
+	if err := biz.Validate(); err != nil {
+		return nil, err
+	}
+
+	conf := &BizConf{def: *def}
+	conf.value.Store(biz)
+	return conf, nil
+}
+
+// BizConf 支持热更新的业务配置
+type BizConf struct {
+	def   Biz
+	value atomic.Value // *Biz
+}
 
+// OnConfigChanged 先解析到副本并校验，成功后才替换，失败时保持原配置不变
+func (c *BizConf) OnConfigChanged(key string, data []byte) error {
 	switch key {
 	case BizConfKey:
-		return json.Unmarshal(data, biz)
+		next := c.def
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&next); err != nil {
+			return errors.Wrapf(err, "decode '%v'", key)
+		}
+
+		if err := next.Validate(); err != nil {
+			return errors.Wrapf(err, "validate '%v'", key)
+		}
+
+		c.value.Store(&next)
+		return nil
 	default:
 		return errors.Errorf("unknwon key '%v'", key)
 	}
 }
 
-func (biz *BizConf) GetThirdParty() string {
-	biz.RLock()
-	defer biz.RUnlock()
-
-	if biz.ThirdParty == "" {
-		return "http://httpbin.org"
-	}
+// Get 当前生效的配置
+func (c *BizConf) Get() *Biz {
+	return c.value.Load().(*Biz)
+}
 
-	return biz.ThirdParty
+func (c *BizConf) GetThirdParty() string {
+	return c.Get().ThirdParty
 }
@@ -0,0 +1,42 @@
+package config
+
+import "testing"
+
+func TestBizConfOnConfigChanged(t *testing.T) {
+	def := &Biz{ThirdParty: "http://httpbin.org"}
+	conf, err := NewBizConf(&Biz{ThirdParty: "http://a.com"}, def)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, data := range []string{
+		`{"thirdParty": "http://b.com"`,   // 语法错误
+		`{"thirdParty": "ftp://b.com"}`,   // 校验失败
+		`{"thirdParty2": "http://b.com"}`, // 未知字段
+	} {
+		if err = conf.OnConfigChanged(BizConfKey, []byte(data)); err == nil {
+			t.Fatalf("expect error for %s", data)
+		}
+
+		if conf.GetThirdParty() != "http://a.com" {
+			t.Fatalf("config changed by rejected update %s", data)
+		}
+	}
+
+	if err = conf.OnConfigChanged(BizConfKey, []byte(`{"thirdParty": "https://b.com"}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	if conf.GetThirdParty() != "https://b.com" {
+		t.Fatalf("unexpected thirdParty %s", conf.GetThirdParty())
+	}
+
+	// 缺少的字段使用默认值
+	if err = conf.OnConfigChanged(BizConfKey, []byte(`{}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	if conf.GetThirdParty() != def.ThirdParty {
+		t.Fatalf("unexpected thirdParty %s", conf.GetThirdParty())
+	}
+}
@@ -13,6 +13,8 @@ type config interface {
 
 type UseCase interface {
 	NewDistLock(key string) store.DistLock
+	NewMultiLock(keys ...string) (store.DistLock, error)
+	NewRedLock(key string) store.DistLock
 	Hello(ctx context.Context, name string) (string, error)
 }
 
@@ -31,3 +33,11 @@ type useCaseImpl struct {
 func (uc *useCaseImpl) NewDistLock(key string) store.DistLock {
 	return uc.dao.NewDistLock(key)
 }
+
+func (uc *useCaseImpl) NewMultiLock(keys ...string) (store.DistLock, error) {
+	return uc.dao.NewMultiLock(keys...)
+}
+
+func (uc *useCaseImpl) NewRedLock(key string) store.DistLock {
+	return uc.dao.NewRedLock(key)
+}
@@ -2,29 +2,113 @@ package store
 
 import (
 	"context"
+	"sync"
+
 	"template/pkg/infra/mongo"
 	"template/pkg/infra/mysql"
 
 	"github.com/go-redis/redis/v8"
 )
 
-var _ Dao = (*daoImpl)(nil)
+var (
+	_ Dao     = (*daoImpl)(nil)
+	_ Swapper = (*daoImpl)(nil)
+)
 
 type Dao interface {
 	Lock
+	NewResumeTokenStore() mongo.ResumeTokenStore
+	PlayerName(ctx context.Context, uid int64) (string, error)
 	Hello(ctx context.Context, name string) (string, error)
 }
 
-func NewDao(redisCli redis.UniversalClient, mysqlCli mysql.Client, mongoCli mongo.Client) Dao {
+// Swapper 运行时替换底层连接，返回旧连接，由调用方负责关闭
+type Swapper interface {
+	SwapRedis(cli redis.UniversalClient) redis.UniversalClient
+	SwapRedlock(clis []redis.UniversalClient) []redis.UniversalClient
+	SwapMySQL(cli mysql.Client) mysql.Client
+	SwapMongo(cli mongo.Client) mongo.Client
+}
+
+// NewDao shardCli 自己处理配置变更，不需要替换；redlockClis 为相互独立的 redis 主节点
+func NewDao(redisCli redis.UniversalClient, redlockClis []redis.UniversalClient, mysqlCli mysql.Client,
+	mongoCli mongo.Client, shardCli mysql.ShardClient) Dao {
 	return &daoImpl{
-		redisRepo: redisCli,
-		sqlRepo:   mysqlCli,
-		mongoRepo: mongoCli,
+		redisRepo:   redisCli,
+		redlockRepo: redlockClis,
+		sqlRepo:     mysqlCli,
+		mongoRepo:   mongoCli,
+		shardRepo:   shardCli,
 	}
 }
 
 type daoImpl struct {
-	redisRepo redis.UniversalClient
-	sqlRepo   mysql.Client
-	mongoRepo mongo.Client
+	sync.RWMutex
+	redisRepo   redis.UniversalClient
+	redlockRepo []redis.UniversalClient
+	sqlRepo     mysql.Client
+	mongoRepo   mongo.Client
+	shardRepo   mysql.ShardClient
+}
+
+func (d *daoImpl) redisCli() redis.UniversalClient {
+	d.RLock()
+	defer d.RUnlock()
+	return d.redisRepo
+}
+
+func (d *daoImpl) redlockClis() []redis.UniversalClient {
+	d.RLock()
+	defer d.RUnlock()
+	return d.redlockRepo
+}
+
+func (d *daoImpl) sqlCli() mysql.Client {
+	d.RLock()
+	defer d.RUnlock()
+	return d.sqlRepo
+}
+
+func (d *daoImpl) mongoCli() mongo.Client {
+	d.RLock()
+	defer d.RUnlock()
+	return d.mongoRepo
+}
+
+func (d *daoImpl) shardCli() mysql.ShardClient {
+	d.RLock()
+	defer d.RUnlock()
+	return d.shardRepo
+}
+
+func (d *daoImpl) SwapRedis(cli redis.UniversalClient) redis.UniversalClient {
+	d.Lock()
+	defer d.Unlock()
+	old := d.redisRepo
+	d.redisRepo = cli
+	return old
+}
+
+func (d *daoImpl) SwapRedlock(clis []redis.UniversalClient) []redis.UniversalClient {
+	d.Lock()
+	defer d.Unlock()
+	old := d.redlockRepo
+	d.redlockRepo = clis
+	return old
+}
+
+func (d *daoImpl) SwapMySQL(cli mysql.Client) mysql.Client {
+	d.Lock()
+	defer d.Unlock()
+	old := d.sqlRepo
+	d.sqlRepo = cli
+	return old
+}
+
+func (d *daoImpl) SwapMongo(cli mongo.Client) mongo.Client {
+	d.Lock()
+	defer d.Unlock()
+	old := d.mongoRepo
+	d.mongoRepo = cli
+	return old
 }
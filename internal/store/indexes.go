@@ -0,0 +1,22 @@
+package store
+
+import (
+	"context"
+
+	"template/pkg/infra/mongo"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// mongoIndexes mongodb 的索引声明，key 为集合名
+var mongoIndexes = map[string][]mongo.Index{
+	"player": {
+		{Keys: bson.D{{Key: "uid", Value: 1}}, Unique: true},
+		{Keys: bson.D{{Key: "name", Value: 1}}},
+	},
+}
+
+// SyncIndexes 按声明检查和同步 mongodb 的索引
+func SyncIndexes(ctx context.Context, cli mongo.Client, opts mongo.SyncIndexOptions) (*mongo.IndexReport, error) {
+	return cli.SyncIndexes(ctx, mongoIndexes, opts)
+}
@@ -3,14 +3,54 @@ package store
 import (
 	"context"
 	"fmt"
+	"sort"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/go-redis/redis/v8"
+	"github.com/pkg/errors"
 	"github.com/rs/xid"
+	"github.com/rs/zerolog/log"
 )
 
 const (
-	dLockPrefix = "ffa:game:lock:{%v}"
+	dLockPrefix  = "ffa:game:lock:{%v}"
+	dTagPrefix   = "ffa:game:lock:%v" // key 中已有 hash tag 时不再加括号
+	dFenceSuffix = ":fence"           // 与锁在同一个 slot，计数不过期，保证 fencing token 单调递增
+
+	// 加锁成功后递增 fencing token
+	lockLua = `
+		if redis.call("SET", KEYS[1], ARGV[1], "NX", "PX", ARGV[2]) == false then
+			return false
+		end
+
+		return redis.call("INCR", KEYS[2])
+	`
+
+	// 只有持有者可以续期
+	renewLockLua = `
+		if redis.call("GET", KEYS[1]) ~= ARGV[1] then
+			return 0
+		end
+
+		return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+	`
+
+	// 所有 key 都由持有者持有时才续期
+	renewMultiLockLua = `
+		for _, v in ipairs(KEYS) do
+			if redis.call("GET", v) ~= ARGV[1] then
+				return 0
+			end
+		end
+
+		for _, v in ipairs(KEYS) do
+			redis.call("PEXPIRE", v, ARGV[2])
+		end
+
+		return 1
+	`
 
 	// redis-cli --eval delLockLua.lua lock:user , haha
 	delLockLua = `
@@ -25,13 +65,16 @@ const (
 		return redis.call("DEL", key)
 	`
 
-	// redis-cli -c -p 7000  --eval multiLock.lua {lock}:ddd {lock}:ccc , haha 100000
+	// redis-cli -c -p 7000  --eval multiLock.lua {lock}:ddd {lock}:ccc {lock}:ddd:fence {lock}:ccc:fence , haha 100000
+	// KEYS 前一半为锁，后一半为对应的 fencing 计数；加锁成功后递增每个计数，再都设为其中的最大值，
+	// 之后单独锁其中任何一个 key 得到的 token 都更大
 	multiLockLua = `
 		local token = ARGV[1]
 		local expire = ARGV[2]
+		local n = #KEYS / 2
 
-		for i, v in ipairs(KEYS) do
-			if (redis.call("SET", v, token, "NX", "PX", expire) == false) then
+		for i = 1, n do
+			if (redis.call("SET", KEYS[i], token, "NX", "PX", expire) == false) then
 				for k=i-1,1,-1 do
 					redis.call("DEL", KEYS[k])
 				end
@@ -39,7 +82,19 @@ const (
 			end
 		end
 
-		return "OK"
+		local fence = 0
+		for i = n + 1, 2 * n do
+			local v = redis.call("INCR", KEYS[i])
+			if v > fence then
+				fence = v
+			end
+		end
+
+		for i = n + 1, 2 * n do
+			redis.call("SET", KEYS[i], fence)
+		end
+
+		return fence
 	`
 
 	// redis-cli -c -p 7000 --eval delMultiLock.lua {lock}:ddd {lock}:ccc , haha
@@ -58,66 +113,360 @@ const (
 	`
 )
 
+var (
+	// ErrNotLocked 锁被其他人持有
+	ErrNotLocked = errors.New("lock is held by others")
+
+	// ErrLockLost 锁已过期或被其他人持有
+	ErrLockLost = errors.New("lock lost")
+
+	// ErrCrossSlot 集群模式下多个 key 不在同一个 slot
+	ErrCrossSlot = errors.New("lock keys must share the same hash tag in cluster mode")
+)
+
+const lockRetryInterval = 50 * time.Millisecond
+
 type Lock interface {
 	NewDistLock(key string) DistLock
+
+	// NewMultiLock 原子地锁住多个 key，全部成功或全部失败，不需要约定加锁顺序；
+	// 集群模式下所有 key 需要相同的 hash tag，例如 "{trade:1}:p1"、"{trade:1}:p2"
+	NewMultiLock(keys ...string) (DistLock, error)
+
+	// NewRedLock 在 redis 配置的 redlock 节点上加锁，没有配置时加锁返回 ErrNoRedlock
+	NewRedLock(key string) DistLock
 }
 
-// DistLock 分布式锁
+// DistLock 分布式锁，ctx 控制等待和续期，ctx 结束后停止续期并释放锁
 type DistLock interface {
-	UnLock() bool
-	Lock() bool
-	TryLock(tryTimes, milliSleep int) bool
+	// Lock 等待直到获得锁或 ctx 结束
+	Lock(ctx context.Context, ttl time.Duration) (Lease, error)
+
+	// TryLock 最多尝试 tryTimes 次，每次间隔 interval
+	TryLock(ctx context.Context, ttl time.Duration, tryTimes int, interval time.Duration) (Lease, error)
+}
+
+// Lease 持有中的锁，后台每 ttl/3 续期一次
+type Lease interface {
+	// Token fencing token，每次加锁递增，写存储时只接受不小于已记录值的 token
+	Token() int64
+
+	// Context 锁丢失或释放后结束，下游调用使用它可以及时停止
+	Context() context.Context
+
+	// Lost 续期失败、锁被其他人持有时关闭
+	Lost() <-chan struct{}
+
+	// Unlock 释放锁，锁已丢失时返回 ErrLockLost
+	Unlock() error
 }
 
 // NewDistLock ...
 func (d *daoImpl) NewDistLock(key string) DistLock {
+	key = lockKey(key)
 	return &redisDistLock{
-		key:   fmt.Sprintf(dLockPrefix, key),
-		token: xid.New().String(),
-		cli:   d.redisRepo,
+		keys:   []string{key},
+		fences: []string{key + dFenceSuffix},
+		cli:    d.redisCli,
 	}
 }
 
-type redisDistLock struct {
-	key   string
-	token string
-	cli   redis.UniversalClient
+// NewMultiLock 没有 hash tag 的 key 与 NewDistLock 使用相同的锁，单机模式下两者互斥
+func (d *daoImpl) NewMultiLock(keys ...string) (DistLock, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("no lock keys")
+	}
+
+	seen := make(map[string]struct{}, len(keys))
+	locks := make([]string, 0, len(keys))
+	fences := make([]string, 0, len(keys))
+	for _, key := range keys {
+		key = lockKey(key)
+		if _, ok := seen[key]; ok {
+			continue
+		}
+		seen[key] = struct{}{}
+		locks = append(locks, key)
+	}
+
+	sort.Strings(locks)
+	for _, key := range locks {
+		fences = append(fences, key+dFenceSuffix)
+	}
+
+	cli := d.redisCli
+	if _, ok := cli().(*redis.ClusterClient); ok {
+		tag := hashTag(locks[0])
+		for _, key := range locks[1:] {
+			if hashTag(key) != tag {
+				return nil, errors.Wrapf(ErrCrossSlot, "%v and %v", locks[0], key)
+			}
+		}
+	}
+
+	return &redisDistLock{
+		keys:   locks,
+		fences: fences,
+		cli:    cli,
+	}, nil
 }
 
-// UnLock ...
-func (r *redisDistLock) UnLock() bool {
-	value, err := r.cli.Eval(context.TODO(), delLockLua, []string{r.key}, r.token).Int()
-	if err != nil {
-		return false
+func lockKey(key string) string {
+	if hashTag(key) != key {
+		return fmt.Sprintf(dTagPrefix, key)
+	}
+	return fmt.Sprintf(dLockPrefix, key)
+}
+
+// hashTag 与 redis 集群计算 slot 的规则相同，没有 hash tag 时为整个 key
+func hashTag(key string) string {
+	start := strings.IndexByte(key, '{')
+	if start < 0 {
+		return key
+	}
+
+	end := strings.IndexByte(key[start+1:], '}')
+	if end <= 0 {
+		return key
 	}
 
-	return value != 0
+	return key[start+1 : start+1+end]
+}
+
+// redisDistLock keys 大于一个时为多键锁；每次请求时取当前的连接，
+// 持有锁期间 redis 配置热更新、旧连接关闭后仍然可以续期和释放
+type redisDistLock struct {
+	keys   []string
+	fences []string // 每个 key 的 fencing 计数
+	cli    func() redis.UniversalClient
+}
+
+func (r *redisDistLock) name() string {
+	return strings.Join(r.keys, ",")
+}
+
+// locker 单节点锁和 redlock 共用加锁重试、续期和释放的流程
+type locker interface {
+	name() string
+
+	// acquire 获得锁时返回 fencing token，锁被其他人持有时返回 ErrNotLocked
+	acquire(ctx context.Context, token string, ttl time.Duration) (int64, error)
+
+	// renew 锁已不属于持有者时返回 false，出错时可以重试
+	renew(ctx context.Context, token string, ttl time.Duration) (bool, error)
+
+	// release 部分 key 已经不属于持有者时返回 false
+	release(ctx context.Context, token string) (bool, error)
+}
+
+// clockDrift 各节点时钟速度不同，锁的有效期按 ttl 的 1% 再加 2ms 扣减
+func clockDrift(ttl time.Duration) time.Duration {
+	return ttl/100 + 2*time.Millisecond
 }
 
 // Lock ...
-func (r *redisDistLock) Lock() bool {
-	return r.getRedisLock(r.key, r.token)
+func (r *redisDistLock) Lock(ctx context.Context, ttl time.Duration) (Lease, error) {
+	return r.TryLock(ctx, ttl, 0, lockRetryInterval)
 }
 
 // TryLock ...
-func (r *redisDistLock) TryLock(tryTime, milliSleep int) (ok bool) {
-	for i := 0; i < tryTime; i++ {
-		ok = r.getRedisLock(r.key, r.token)
-		if ok {
-			return
+func (r *redisDistLock) TryLock(ctx context.Context, ttl time.Duration, tryTimes int, interval time.Duration) (Lease, error) {
+	return tryLock(ctx, r, ttl, tryTimes, interval)
+}
+
+// tryLock tryTimes 小于等于 0 时一直尝试到 ctx 结束
+func tryLock(ctx context.Context, lk locker, ttl time.Duration, tryTimes int, interval time.Duration) (Lease, error) {
+	token := xid.New().String()
+	for i := 0; tryTimes <= 0 || i < tryTimes; i++ {
+		start := time.Now()
+		fence, err := lk.acquire(ctx, token, ttl)
+		if err == nil {
+			return newLease(ctx, lk, token, fence, ttl, start), nil
+		}
+		if err != ErrNotLocked {
+			return nil, err
 		}
 
-		time.Sleep(time.Duration(milliSleep) * time.Millisecond)
+		if tryTimes > 0 && i == tryTimes-1 {
+			break
+		}
+
+		timer := time.NewTimer(interval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
 	}
 
-	return
+	return nil, ErrNotLocked
 }
 
-func (r *redisDistLock) getRedisLock(key string, token string) bool {
-	const dLockExpire = 1000 // ms
-	value, err := r.cli.SetNX(context.TODO(), key, token, time.Millisecond*dLockExpire).Result()
+func (r *redisDistLock) acquire(ctx context.Context, token string, ttl time.Duration) (int64, error) {
+	if len(r.keys) > 1 {
+		return r.acquireMulti(ctx, token, ttl)
+	}
+
+	fence, err := r.cli().Eval(ctx, lockLua, []string{r.keys[0], r.fences[0]}, token, ttl.Milliseconds()).Int64()
+	if err == redis.Nil {
+		return 0, ErrNotLocked
+	}
 	if err != nil {
-		return false
+		return 0, errors.Wrapf(err, "lock %v", r.name())
+	}
+
+	return fence, nil
+}
+
+// acquireMulti 加锁和递增计数在同一个脚本中，加锁失败时计数不变
+func (r *redisDistLock) acquireMulti(ctx context.Context, token string, ttl time.Duration) (int64, error) {
+	keys := append(append(make([]string, 0, len(r.keys)*2), r.keys...), r.fences...)
+	fence, err := r.cli().Eval(ctx, multiLockLua, keys, token, ttl.Milliseconds()).Int64()
+	if err == redis.Nil {
+		return 0, ErrNotLocked
+	}
+	if err != nil {
+		return 0, errors.Wrapf(err, "lock %v", r.name())
+	}
+
+	return fence, nil
+}
+
+func (r *redisDistLock) renew(ctx context.Context, token string, ttl time.Duration) (bool, error) {
+	script := renewLockLua
+	if len(r.keys) > 1 {
+		script = renewMultiLockLua
+	}
+
+	n, err := r.cli().Eval(ctx, script, r.keys, token, ttl.Milliseconds()).Int()
+	return n == 1, err
+}
+
+func (r *redisDistLock) release(ctx context.Context, token string) (bool, error) {
+	if len(r.keys) > 1 {
+		n, err := r.cli().Eval(ctx, delMultiLockLua, r.keys, token).Int()
+		return n == len(r.keys), err
+	}
+
+	n, err := r.cli().Eval(ctx, delLockLua, r.keys, token).Int()
+	return n != 0, err
+}
+
+// newLease start 为加锁请求发出的时间，锁的有效期从这时开始计算
+func newLease(ctx context.Context, lk locker, token string, fence int64, ttl time.Duration, start time.Time) *redisLease {
+	leaseCtx, cancel := context.WithCancel(ctx)
+	l := &redisLease{
+		lock:    lk,
+		token:   token,
+		fence:   fence,
+		ttl:     ttl,
+		expiry:  start.Add(ttl - clockDrift(ttl)),
+		ctx:     leaseCtx,
+		cancel:  cancel,
+		lost:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+
+	go l.watchdog()
+	return l
+}
+
+type redisLease struct {
+	lock   locker
+	token  string
+	fence  int64
+	ttl    time.Duration
+	expiry time.Time // 只在 watchdog 中读写
+
+	ctx     context.Context
+	cancel  context.CancelFunc
+	lost    chan struct{}
+	stopped chan struct{} // watchdog 退出
+	once    sync.Once
+	err     error
+}
+
+func (l *redisLease) Token() int64 {
+	return l.fence
+}
+
+func (l *redisLease) Context() context.Context {
+	return l.ctx
+}
+
+func (l *redisLease) Lost() <-chan struct{} {
+	return l.lost
+}
+
+// Unlock 可以重复调用，只有第一次释放锁
+func (l *redisLease) Unlock() error {
+	l.once.Do(func() {
+		l.cancel()
+		<-l.stopped
+
+		select {
+		case <-l.lost:
+			l.err = ErrLockLost
+			return
+		default:
+		}
+
+		// 请求的 ctx 可能已经结束，释放使用新的 ctx
+		ctx, cancel := context.WithTimeout(context.Background(), l.ttl)
+		defer cancel()
+
+		ok, err := l.lock.release(ctx, l.token)
+		switch {
+		case err != nil:
+			l.err = errors.Wrapf(err, "unlock %v", l.lock.name())
+		case !ok:
+			l.err = ErrLockLost
+		}
+	})
+
+	return l.err
+}
+
+// watchdog 续期直到 Unlock 或 ctx 结束，续期出错时重试，超过有效期仍未成功视为丢失
+func (l *redisLease) watchdog() {
+	defer close(l.stopped)
+
+	interval := l.ttl / 3
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-l.ctx.Done():
+			// ctx 结束但没有调用 Unlock 时自动释放
+			go func() { _ = l.Unlock() }()
+			return
+		case <-ticker.C:
+		}
+
+		start := time.Now()
+		ctx, cancel := context.WithTimeout(l.ctx, interval)
+		ok, err := l.lock.renew(ctx, l.token, l.ttl)
+		cancel()
+
+		switch {
+		case err == nil && ok:
+			l.expiry = start.Add(l.ttl - clockDrift(l.ttl))
+			continue
+		case err == nil:
+			log.Warn().Str("key", l.lock.name()).Int64("fence", l.fence).Msg("lock lost")
+		case l.ctx.Err() != nil:
+			continue
+		case time.Now().Before(l.expiry):
+			log.Warn().Err(err).Str("key", l.lock.name()).Msg("failed to renew lock")
+			continue
+		default:
+			log.Error().Err(err).Str("key", l.lock.name()).Int64("fence", l.fence).Msg("lock expired")
+		}
+
+		close(l.lost)
+		l.cancel()
+		return
 	}
-	return value
 }
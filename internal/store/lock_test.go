@@ -0,0 +1,305 @@
+package store
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/pkg/errors"
+)
+
+func TestLockKey(t *testing.T) {
+	for key, want := range map[string]string{
+		"1001":           "ffa:game:lock:{1001}",
+		"{trade:1}:1001": "ffa:game:lock:{trade:1}:1001",
+		"{}1001":         "ffa:game:lock:{{}1001}",
+	} {
+		if got := lockKey(key); got != want {
+			t.Fatalf("lockKey(%v) = %v, want %v", key, got, want)
+		}
+	}
+}
+
+func TestNewMultiLock(t *testing.T) {
+	cluster := redis.NewClusterClient(&redis.ClusterOptions{Addrs: []string{"127.0.0.1:7000"}})
+	defer cluster.Close()
+
+	d := &daoImpl{redisRepo: cluster}
+	if _, err := d.NewMultiLock("1001", "1002"); errors.Cause(err) != ErrCrossSlot {
+		t.Fatalf("expect cross slot error, got %v", err)
+	}
+
+	lock, err := d.NewMultiLock("{trade:1}:1002", "{trade:1}:1001", "{trade:1}:1002")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := lock.(*redisDistLock)
+	if len(r.keys) != 2 || r.keys[0] != "ffa:game:lock:{trade:1}:1001" || len(r.fences) != 2 ||
+		r.fences[0] != r.keys[0]+dFenceSuffix || r.fences[1] != r.keys[1]+dFenceSuffix {
+		t.Fatalf("unexpected keys %v fences %v", r.keys, r.fences)
+	}
+
+	single := &daoImpl{redisRepo: redis.NewClient(&redis.Options{Addr: "127.0.0.1:6379"})}
+	defer single.redisRepo.Close()
+	if _, err = single.NewMultiLock("1001", "1002"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRedLockUnavailable(t *testing.T) {
+	d := &daoImpl{}
+	if _, err := d.NewRedLock("1001").TryLock(context.Background(), time.Second, 1, 0); err != ErrNoRedlock {
+		t.Fatalf("expect ErrNoRedlock, got %v", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		d.redlockRepo = append(d.redlockRepo, redis.NewClient(&redis.Options{Addr: "127.0.0.1:1", MaxRetries: -1}))
+	}
+	defer closeAll(d.redlockRepo)
+
+	// 可用节点不足半数时直接返回错误，不当作锁被占用而重试
+	_, err := d.NewRedLock("1001").Lock(context.Background(), time.Second)
+	if err == nil || err == ErrNotLocked {
+		t.Fatalf("expect node error, got %v", err)
+	}
+}
+
+func closeAll(clis []redis.UniversalClient) {
+	for _, cli := range clis {
+		_ = cli.Close()
+	}
+}
+
+// fakeLocker 内存中的单节点锁，行为与 lua 脚本一致
+type fakeLocker struct {
+	sync.Mutex
+	owner    string
+	expiry   time.Time
+	fence    int64
+	acquires int
+	renews   int
+	releases int
+}
+
+func (f *fakeLocker) name() string {
+	return "fake"
+}
+
+func (f *fakeLocker) held() bool {
+	return f.owner != "" && time.Now().Before(f.expiry)
+}
+
+func (f *fakeLocker) acquire(ctx context.Context, token string, ttl time.Duration) (int64, error) {
+	f.Lock()
+	defer f.Unlock()
+	f.acquires++
+	if f.held() {
+		return 0, ErrNotLocked
+	}
+
+	f.owner, f.expiry = token, time.Now().Add(ttl)
+	f.fence++
+	return f.fence, nil
+}
+
+func (f *fakeLocker) renew(ctx context.Context, token string, ttl time.Duration) (bool, error) {
+	f.Lock()
+	defer f.Unlock()
+	f.renews++
+	if !f.held() || f.owner != token {
+		return false, nil
+	}
+
+	f.expiry = time.Now().Add(ttl)
+	return true, nil
+}
+
+func (f *fakeLocker) release(ctx context.Context, token string) (bool, error) {
+	f.Lock()
+	defer f.Unlock()
+	f.releases++
+	if !f.held() || f.owner != token {
+		return false, nil
+	}
+
+	f.owner = ""
+	return true, nil
+}
+
+// takeOver 模拟锁过期后被其他人获得
+func (f *fakeLocker) takeOver() {
+	f.Lock()
+	defer f.Unlock()
+	f.owner, f.expiry = "other", time.Now().Add(time.Minute)
+}
+
+func (f *fakeLocker) stats() (held bool, acquires, renews, releases int) {
+	f.Lock()
+	defer f.Unlock()
+	return f.held(), f.acquires, f.renews, f.releases
+}
+
+func TestClockDrift(t *testing.T) {
+	if d := clockDrift(time.Second); d != 12*time.Millisecond {
+		t.Fatalf("unexpected drift %v", d)
+	}
+}
+
+func TestLeaseRenew(t *testing.T) {
+	lk := &fakeLocker{}
+	lease, err := tryLock(context.Background(), lk, 60*time.Millisecond, 1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 持有时间超过 ttl，续期后仍然有效
+	time.Sleep(200 * time.Millisecond)
+	if held, _, renews, _ := lk.stats(); !held || renews < 3 {
+		t.Fatalf("expect renewed lock, held %v renews %v", held, renews)
+	}
+
+	select {
+	case <-lease.Lost():
+		t.Fatal("lease lost while renewing")
+	default:
+	}
+
+	if err = lease.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+	if held, _, _, _ := lk.stats(); held {
+		t.Fatal("lock not released")
+	}
+}
+
+func TestLeaseLost(t *testing.T) {
+	lk := &fakeLocker{}
+	lease, err := tryLock(context.Background(), lk, 60*time.Millisecond, 1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lk.takeOver()
+	select {
+	case <-lease.Lost():
+	case <-time.After(time.Second):
+		t.Fatal("expect lease lost after take over")
+	}
+
+	if lease.Context().Err() == nil {
+		t.Fatal("expect lease context canceled")
+	}
+	if err = lease.Unlock(); err != ErrLockLost {
+		t.Fatalf("expect ErrLockLost, got %v", err)
+	}
+	if held, _, _, _ := lk.stats(); !held {
+		t.Fatal("lock of the new owner released")
+	}
+}
+
+func TestLeaseReleaseOnCancel(t *testing.T) {
+	lk := &fakeLocker{}
+	ctx, cancel := context.WithCancel(context.Background())
+	lease, err := tryLock(ctx, lk, time.Minute, 1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cancel()
+	deadline := time.Now().Add(time.Second)
+	for {
+		if held, _, _, _ := lk.stats(); !held {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("lock not released after context canceled")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	if err = lease.Unlock(); err != nil {
+		t.Fatalf("expect released lease, got %v", err)
+	}
+}
+
+func TestLeaseUnlockIdempotent(t *testing.T) {
+	lk := &fakeLocker{}
+	lease, err := tryLock(context.Background(), lk, time.Minute, 1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 3; i++ {
+		if err = lease.Unlock(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, _, _, releases := lk.stats(); releases != 1 {
+		t.Fatalf("expect released once, got %v", releases)
+	}
+}
+
+func TestLeaseFence(t *testing.T) {
+	lk := &fakeLocker{}
+	var last int64
+	for i := 0; i < 3; i++ {
+		lease, err := tryLock(context.Background(), lk, time.Minute, 1, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if lease.Token() <= last {
+			t.Fatalf("fence %v not greater than %v", lease.Token(), last)
+		}
+		last = lease.Token()
+		_ = lease.Unlock()
+	}
+}
+
+func TestTryLockRetry(t *testing.T) {
+	lk := &fakeLocker{}
+	lk.takeOver()
+
+	if _, err := tryLock(context.Background(), lk, time.Second, 3, time.Millisecond); err != ErrNotLocked {
+		t.Fatalf("expect ErrNotLocked, got %v", err)
+	}
+	if _, acquires, _, _ := lk.stats(); acquires != 3 {
+		t.Fatalf("expect 3 attempts, got %v", acquires)
+	}
+
+	// 等待期间 ctx 结束
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := tryLock(ctx, lk, time.Second, 0, 5*time.Millisecond); err != context.DeadlineExceeded {
+		t.Fatalf("expect deadline exceeded, got %v", err)
+	}
+}
+
+func TestRedLockCanceled(t *testing.T) {
+	d := &daoImpl{}
+	for i := 0; i < 3; i++ {
+		d.redlockRepo = append(d.redlockRepo, newFakeRedis(t))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := d.NewRedLock("1001").Lock(ctx, time.Second); err != context.Canceled {
+		t.Fatalf("expect context canceled, got %v", err)
+	}
+}
+
+func TestLockResolvesSwappedClient(t *testing.T) {
+	old, next := newFakeRedis(t), newFakeRedis(t)
+	d := &daoImpl{redisRepo: old, redlockRepo: []redis.UniversalClient{old}}
+	lock := d.NewDistLock("1001").(*redisDistLock)
+	red := d.NewRedLock("1001").(*redLock)
+
+	// 热更新后加锁、续期、释放使用新的连接
+	d.SwapRedis(next)
+	d.SwapRedlock([]redis.UniversalClient{next})
+	if lock.cli() != next || red.nodes()[0] != next {
+		t.Fatal("lock still uses the old client")
+	}
+}
@@ -0,0 +1,17 @@
+package store
+
+import (
+	"embed"
+
+	"template/pkg/infra/mysql"
+
+	"github.com/jmoiron/sqlx"
+)
+
+//go:embed migrations/*.sql
+var migrations embed.FS
+
+// NewMigrator db_player 的表结构迁移，脚本随程序一起发布
+func NewMigrator(db *sqlx.DB) (*mysql.Migrator, error) {
+	return mysql.NewMigrator(db, migrations, "migrations")
+}
@@ -0,0 +1,14 @@
+package store
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+)
+
+// PlayerName player 表按 uid 分片
+func (d *daoImpl) PlayerName(ctx context.Context, uid int64) (string, error) {
+	var name string
+	err := d.shardCli().QuerySingle(ctx, "player", &name, "select name from {player} where id = ?", uid)
+	return name, errors.Wrapf(err, "player %v", uid)
+}
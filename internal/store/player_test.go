@@ -0,0 +1,37 @@
+package store
+
+import (
+	"context"
+	"testing"
+
+	"template/pkg/infra/mysql"
+)
+
+type fakeShard struct {
+	mysql.ShardClient
+	table string
+	query string
+	args  []interface{}
+}
+
+func (f *fakeShard) QuerySingle(_ context.Context, table string, dest interface{}, query string, args ...interface{}) error {
+	f.table, f.query, f.args = table, query, args
+	*dest.(*string) = "neil"
+	return nil
+}
+
+func TestPlayerNameRoutesByUid(t *testing.T) {
+	shard := &fakeShard{}
+	d := NewDao(nil, nil, nil, nil, shard)
+
+	name, err := d.PlayerName(context.Background(), 42)
+	if err != nil || name != "neil" {
+		t.Fatalf("unexpected result %v %v", name, err)
+	}
+	if shard.table != "player" || shard.query != "select name from {player} where id = ?" {
+		t.Fatalf("unexpected route %v %q", shard.table, shard.query)
+	}
+	if len(shard.args) != 1 || shard.args[0] != int64(42) {
+		t.Fatalf("unexpected shard key %v", shard.args)
+	}
+}
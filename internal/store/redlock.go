@@ -0,0 +1,192 @@
+package store
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/pkg/errors"
+)
+
+// ErrNoRedlock 没有配置 redlock 节点
+var ErrNoRedlock = errors.New("redlock nodes are not configured")
+
+// releaseTimeout 释放时没有设置超时使用的默认值
+const releaseTimeout = 3 * time.Second
+
+// NewRedLock 在多个独立的 redis 主节点上加锁，过半节点成功才算获得锁，主从切换时不会丢锁
+func (d *daoImpl) NewRedLock(key string) DistLock {
+	key = lockKey(key)
+	return &redLock{
+		key:   key,
+		fence: key + dFenceSuffix,
+		nodes: d.redlockClis,
+	}
+}
+
+// redLock 每次请求时取当前的节点，热更新后旧连接关闭不影响续期和释放；
+// 节点列表变化时新节点上没有锁，续期会因为不足半数而丢锁
+type redLock struct {
+	key   string
+	fence string
+	nodes func() []redis.UniversalClient
+}
+
+func (r *redLock) name() string {
+	return r.key
+}
+
+func quorum(nodes []redis.UniversalClient) int {
+	return len(nodes)/2 + 1
+}
+
+// Lock ...
+func (r *redLock) Lock(ctx context.Context, ttl time.Duration) (Lease, error) {
+	return r.TryLock(ctx, ttl, 0, lockRetryInterval)
+}
+
+// TryLock ...
+func (r *redLock) TryLock(ctx context.Context, ttl time.Duration, tryTimes int, interval time.Duration) (Lease, error) {
+	if len(r.nodes()) == 0 {
+		return nil, ErrNoRedlock
+	}
+	return tryLock(ctx, r, ttl, tryTimes, interval)
+}
+
+// nodeTimeout 单个节点的超时远小于 ttl，避免在故障节点上耗尽有效期
+func (r *redLock) nodeTimeout(ttl time.Duration) time.Duration {
+	timeout := ttl / 10
+	if timeout < 5*time.Millisecond {
+		timeout = 5 * time.Millisecond
+	}
+	return timeout
+}
+
+// each 并发地在所有节点上执行 fn，返回成功、出错的节点数和最后一个错误
+func (r *redLock) each(ctx context.Context, nodes []redis.UniversalClient, timeout time.Duration, fn func(ctx context.Context, cli redis.UniversalClient) (bool, error)) (success, failed int, lastErr error) {
+	var (
+		wg sync.WaitGroup
+		mu sync.Mutex
+	)
+
+	for i, cli := range nodes {
+		wg.Add(1)
+		go func(i int, cli redis.UniversalClient) {
+			defer wg.Done()
+
+			ctx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+
+			ok, err := fn(ctx, cli)
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case err != nil:
+				failed++
+				lastErr = errors.Wrapf(err, "redlock node %v", i)
+			case ok:
+				success++
+			}
+		}(i, cli)
+	}
+	wg.Wait()
+
+	return
+}
+
+// acquire 过半节点加锁成功且扣除耗时和时钟漂移后仍有剩余有效期时获得锁，否则释放已经加上的锁；
+// fencing token 为成功节点中的最大值，节点丢失数据时不保证严格递增
+func (r *redLock) acquire(ctx context.Context, token string, ttl time.Duration) (int64, error) {
+	nodes := r.nodes()
+	if len(nodes) == 0 {
+		return 0, ErrNoRedlock
+	}
+
+	start := time.Now()
+
+	var (
+		mu    sync.Mutex
+		fence int64
+	)
+	success, failed, err := r.each(ctx, nodes, r.nodeTimeout(ttl), func(ctx context.Context, cli redis.UniversalClient) (bool, error) {
+		n, err := cli.Eval(ctx, lockLua, []string{r.key, r.fence}, token, ttl.Milliseconds()).Int64()
+		if err == redis.Nil {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		if n > fence {
+			fence = n
+		}
+		return true, nil
+	})
+
+	if ctx.Err() == nil && success >= quorum(nodes) && ttl-time.Since(start)-clockDrift(ttl) > 0 {
+		return fence, nil
+	}
+
+	// 超时的请求可能已经在节点上执行，所有节点都需要释放
+	_, _ = r.release(context.Background(), token)
+
+	// 调用方取消时各节点的错误都是 ctx 的错误，不是节点故障
+	if ctx.Err() != nil {
+		return 0, ctx.Err()
+	}
+
+	// 可用节点不足半数，重试也不会成功
+	if len(nodes)-failed < quorum(nodes) {
+		return 0, errors.Wrapf(err, "lock %v", r.key)
+	}
+	return 0, ErrNotLocked
+}
+
+// renew 过半节点续期成功才算成功，出错的节点恢复后可能成功时返回错误重试
+func (r *redLock) renew(ctx context.Context, token string, ttl time.Duration) (bool, error) {
+	nodes := r.nodes()
+	start := time.Now()
+	success, failed, err := r.each(ctx, nodes, r.nodeTimeout(ttl), func(ctx context.Context, cli redis.UniversalClient) (bool, error) {
+		n, err := cli.Eval(ctx, renewLockLua, []string{r.key}, token, ttl.Milliseconds()).Int()
+		return n == 1, err
+	})
+
+	if success >= quorum(nodes) && ttl-time.Since(start)-clockDrift(ttl) > 0 {
+		return true, nil
+	}
+
+	// 持有锁的节点已经不足半数
+	if success+failed < quorum(nodes) {
+		return false, nil
+	}
+
+	if err == nil {
+		err = errors.New("renew took longer than ttl")
+	}
+	return false, errors.Wrapf(err, "renew %v", r.key)
+}
+
+// release 在所有节点上释放，过半节点仍由持有者持有时返回 true
+func (r *redLock) release(ctx context.Context, token string) (bool, error) {
+	timeout := releaseTimeout
+	if deadline, ok := ctx.Deadline(); ok {
+		timeout = time.Until(deadline)
+	}
+
+	nodes := r.nodes()
+	success, failed, err := r.each(ctx, nodes, timeout, func(ctx context.Context, cli redis.UniversalClient) (bool, error) {
+		n, err := cli.Eval(ctx, delLockLua, []string{r.key}, token).Int()
+		return n != 0, err
+	})
+
+	if success >= quorum(nodes) {
+		return true, nil
+	}
+	if success+failed >= quorum(nodes) {
+		return false, errors.Wrapf(err, "released on %v/%v nodes", success, len(nodes))
+	}
+	return false, nil
+}
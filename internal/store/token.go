@@ -0,0 +1,38 @@
+package store
+
+import (
+	"context"
+
+	"template/pkg/infra/mongo"
+
+	"github.com/go-redis/redis/v8"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+const resumeTokenPrefix = "ffa:game:resume:"
+
+// NewResumeTokenStore change stream 的 resume token 保存在 redis 中，key 为前缀加监听者名字
+func (d *daoImpl) NewResumeTokenStore() mongo.ResumeTokenStore {
+	return &redisTokenStore{cli: d.redisCli, prefix: resumeTokenPrefix}
+}
+
+// redisTokenStore 每次读写时取当前的连接，redis 配置热更新后仍然可用
+type redisTokenStore struct {
+	cli    func() redis.UniversalClient
+	prefix string
+}
+
+func (s *redisTokenStore) Load(ctx context.Context, name string) (bson.Raw, error) {
+	data, err := s.cli().Get(ctx, s.prefix+name).Bytes()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return bson.Raw(data), nil
+}
+
+func (s *redisTokenStore) Save(ctx context.Context, name string, token bson.Raw) error {
+	return s.cli().Set(ctx, s.prefix+name, []byte(token), 0).Err()
+}
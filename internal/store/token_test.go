@@ -0,0 +1,31 @@
+package store
+
+import (
+	"context"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestResumeTokenStore(t *testing.T) {
+	d := &daoImpl{redisRepo: newFakeRedis(t)}
+	tokens := d.NewResumeTokenStore()
+	ctx := context.Background()
+
+	token, err := tokens.Load(ctx, "player")
+	if err != nil || token != nil {
+		t.Fatalf("expect no token, got %v %v", token, err)
+	}
+
+	want, _ := bson.Marshal(bson.M{"_data": "8263A1"})
+	if err = tokens.Save(ctx, "player", want); err != nil {
+		t.Fatal(err)
+	}
+
+	if token, err = tokens.Load(ctx, "player"); err != nil {
+		t.Fatal(err)
+	}
+	if token.Lookup("_data").StringValue() != "8263A1" {
+		t.Fatalf("unexpected token %v", token)
+	}
+}
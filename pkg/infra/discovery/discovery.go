@@ -0,0 +1,15 @@
+package discovery
+
+import (
+	"github.com/asim/go-micro/plugins/registry/consul/v3"
+	"github.com/asim/go-micro/v3/registry"
+)
+
+// NewRegistry standalone 模式使用 mdns，同一局域网内的进程无需 consul 即可互相发现
+func NewRegistry(standalone bool, consulAddr string, opts ...registry.Option) registry.Registry {
+	if standalone {
+		return registry.NewRegistry(opts...)
+	}
+
+	return consul.NewRegistry(append([]registry.Option{registry.Addrs(consulAddr)}, opts...)...)
+}
@@ -0,0 +1,408 @@
+package kv
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/docker/libkv/store"
+	"github.com/fsnotify/fsnotify"
+	"github.com/pkg/errors"
+)
+
+const (
+	filePerm os.FileMode = 0644
+	dirPerm  os.FileMode = 0755
+)
+
+var _ store.Store = (*fileStore)(nil)
+
+// NewFileStore 以本地目录作为 kv 存储，key 为相对路径，value 为文件内容
+// NOTE: 创建 key 在多进程间是原子的，更新和删除的比较只在进程内有效
+func NewFileStore(addrs []string, _ *store.Config) (store.Store, error) {
+	if len(addrs) != 1 || addrs[0] == "" {
+		return nil, errors.New("file store needs exactly one directory")
+	}
+
+	root, err := filepath.Abs(addrs[0])
+	if err != nil {
+		return nil, err
+	}
+
+	if err = os.MkdirAll(root, dirPerm); err != nil {
+		return nil, err
+	}
+
+	return &fileStore{root: root}, nil
+}
+
+type fileStore struct {
+	sync.Mutex
+	root string
+}
+
+func (s *fileStore) path(key string) string {
+	return filepath.Join(s.root, filepath.FromSlash(strings.Trim(key, "/")))
+}
+
+func (s *fileStore) key(path string) string {
+	rel, _ := filepath.Rel(s.root, path)
+	return filepath.ToSlash(rel)
+}
+
+func (s *fileStore) read(key string) (*store.KVPair, error) {
+	path := s.path(key)
+	info, err := os.Stat(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, store.ErrKeyNotFound
+		}
+		return nil, err
+	}
+
+	if info.IsDir() {
+		return nil, store.ErrKeyNotFound
+	}
+
+	value, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return &store.KVPair{
+		Key:       strings.Trim(key, "/"),
+		Value:     value,
+		LastIndex: uint64(info.ModTime().UnixNano()),
+	}, nil
+}
+
+func (s *fileStore) write(key string, value []byte, create bool) error {
+	path := s.path(key)
+	if err := os.MkdirAll(filepath.Dir(path), dirPerm); err != nil {
+		return err
+	}
+
+	// 先写临时文件再重命名，避免读到写了一半的内容
+	tmp, err := ioutil.TempFile(filepath.Dir(path), ".tmp-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err = tmp.Write(value); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+
+	if err = os.Chmod(tmp.Name(), filePerm); err != nil {
+		return err
+	}
+
+	if !create {
+		return os.Rename(tmp.Name(), path)
+	}
+
+	// 硬链接在目标已存在时失败，保证多进程下只有一个能创建成功
+	if err = os.Link(tmp.Name(), path); os.IsExist(err) {
+		return store.ErrKeyExists
+	}
+
+	return err
+}
+
+func (s *fileStore) Put(key string, value []byte, options *store.WriteOptions) error {
+	s.Lock()
+	defer s.Unlock()
+
+	if options != nil && options.IsDir {
+		return os.MkdirAll(s.path(key), dirPerm)
+	}
+
+	return s.write(key, value, false)
+}
+
+func (s *fileStore) Get(key string) (*store.KVPair, error) {
+	return s.read(key)
+}
+
+func (s *fileStore) Delete(key string) error {
+	s.Lock()
+	defer s.Unlock()
+
+	err := os.Remove(s.path(key))
+	if os.IsNotExist(err) {
+		return store.ErrKeyNotFound
+	}
+
+	return err
+}
+
+func (s *fileStore) Exists(key string) (bool, error) {
+	_, err := s.read(key)
+	if err == store.ErrKeyNotFound {
+		return false, nil
+	}
+
+	return err == nil, err
+}
+
+func (s *fileStore) List(directory string) ([]*store.KVPair, error) {
+	dir := s.path(directory)
+	if _, err := os.Stat(dir); err != nil {
+		if os.IsNotExist(err) {
+			return nil, store.ErrKeyNotFound
+		}
+		return nil, err
+	}
+
+	pairs := make([]*store.KVPair, 0)
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if info.IsDir() || strings.HasPrefix(info.Name(), ".tmp-") {
+			return nil
+		}
+
+		pair, err := s.read(s.key(path))
+		if err != nil {
+			return err
+		}
+
+		pairs = append(pairs, pair)
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(pairs, func(i, j int) bool {
+		return pairs[i].Key < pairs[j].Key
+	})
+
+	return pairs, nil
+}
+
+func (s *fileStore) DeleteTree(directory string) error {
+	s.Lock()
+	defer s.Unlock()
+
+	return os.RemoveAll(s.path(directory))
+}
+
+func (s *fileStore) AtomicPut(key string, value []byte, previous *store.KVPair, _ *store.WriteOptions) (bool, *store.KVPair, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	current, err := s.read(key)
+	if err != nil && err != store.ErrKeyNotFound {
+		return false, nil, err
+	}
+
+	if previous == nil {
+		if current != nil {
+			return false, nil, store.ErrKeyExists
+		}
+	} else if current == nil || current.LastIndex != previous.LastIndex {
+		return false, nil, store.ErrKeyModified
+	}
+
+	if err = s.write(key, value, previous == nil); err != nil {
+		return false, nil, err
+	}
+
+	pair, err := s.read(key)
+	if err != nil {
+		return false, nil, err
+	}
+
+	return true, pair, nil
+}
+
+func (s *fileStore) AtomicDelete(key string, previous *store.KVPair) (bool, error) {
+	if previous == nil {
+		return false, store.ErrPreviousNotSpecified
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	current, err := s.read(key)
+	if err != nil {
+		return false, err
+	}
+
+	if current.LastIndex != previous.LastIndex {
+		return false, store.ErrKeyModified
+	}
+
+	if err = os.Remove(s.path(key)); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+func (s *fileStore) NewLock(string, *store.LockOptions) (store.Locker, error) {
+	return nil, store.ErrCallNotSupported
+}
+
+func (s *fileStore) Close() {}
+
+// Watch 监听文件所在目录，编辑器保存文件时通常是重命名替换，直接监听文件会丢失事件
+func (s *fileStore) Watch(key string, stopCh <-chan struct{}) (<-chan *store.KVPair, error) {
+	path := s.path(key)
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, dirPerm); err != nil {
+		return nil, err
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+
+	if err = watcher.Add(dir); err != nil {
+		_ = watcher.Close()
+		return nil, err
+	}
+
+	watchCh := make(chan *store.KVPair)
+	go func() {
+		defer close(watchCh)
+		defer watcher.Close()
+
+		var last []byte
+		send := func() bool {
+			pair, err := s.read(key)
+			if err != nil || (last != nil && bytes.Equal(last, pair.Value)) {
+				return true
+			}
+
+			last = pair.Value
+			select {
+			case watchCh <- pair:
+				return true
+			case <-stopCh:
+				return false
+			}
+		}
+
+		if !send() {
+			return
+		}
+
+		for {
+			select {
+			case <-stopCh:
+				return
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+
+				if filepath.Clean(event.Name) == path && !send() {
+					return
+				}
+			case _, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+			}
+		}
+	}()
+
+	return watchCh, nil
+}
+
+// WatchTree fsnotify 不支持递归监听，需要监听每一级子目录
+func (s *fileStore) WatchTree(directory string, stopCh <-chan struct{}) (<-chan []*store.KVPair, error) {
+	dir := s.path(directory)
+	if err := os.MkdirAll(dir, dirPerm); err != nil {
+		return nil, err
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+
+	err = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || !info.IsDir() {
+			return err
+		}
+		return watcher.Add(path)
+	})
+
+	if err != nil {
+		_ = watcher.Close()
+		return nil, err
+	}
+
+	watchCh := make(chan []*store.KVPair)
+	go func() {
+		defer close(watchCh)
+		defer watcher.Close()
+
+		var last []*store.KVPair
+		send := func() bool {
+			pairs, err := s.List(directory)
+			if err != nil || (last != nil && samePairs(last, pairs)) {
+				return true
+			}
+
+			last = pairs
+			select {
+			case watchCh <- pairs:
+				return true
+			case <-stopCh:
+				return false
+			}
+		}
+
+		if !send() {
+			return
+		}
+
+		for {
+			select {
+			case <-stopCh:
+				return
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+
+				if strings.HasPrefix(filepath.Base(event.Name), ".tmp-") {
+					continue
+				}
+
+				if event.Op&fsnotify.Create == fsnotify.Create {
+					if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
+						_ = watcher.Add(event.Name)
+					}
+				}
+
+				if !send() {
+					return
+				}
+			case _, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+			}
+		}
+	}()
+
+	return watchCh, nil
+}
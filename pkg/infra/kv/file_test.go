@@ -0,0 +1,86 @@
+package kv
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/docker/libkv/store"
+)
+
+func TestFileStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	kvStore, err := NewStore(string(FILE), []string{dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = kvStore.Get("svr/redis"); err != store.ErrKeyNotFound {
+		t.Fatalf("expect ErrKeyNotFound, got %v", err)
+	}
+
+	_, pair, err := kvStore.AtomicPut("svr/redis", []byte(`{"addr":"a"}`), nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err = kvStore.AtomicPut("svr/redis", []byte("x"), nil, nil); err != store.ErrKeyExists {
+		t.Fatalf("expect ErrKeyExists, got %v", err)
+	}
+
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+
+	watchCh, err := kvStore.Watch("svr/redis", stopCh)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	treeCh, err := kvStore.WatchTree("svr", stopCh)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := <-watchCh; string(got.Value) != `{"addr":"a"}` {
+		t.Fatalf("unexpected initial value %s", got.Value)
+	}
+
+	if got := <-treeCh; len(got) != 1 || got[0].Key != "svr/redis" {
+		t.Fatalf("unexpected initial tree %v", got)
+	}
+
+	if _, _, err = kvStore.AtomicPut("svr/redis", []byte(`{"addr":"b"}`), pair, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case got := <-watchCh:
+		if string(got.Value) != `{"addr":"b"}` {
+			t.Fatalf("unexpected value %s", got.Value)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("watch timeout")
+	}
+
+	if err = kvStore.Put("svr/biz/test", []byte("1"), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case got := <-treeCh:
+			if len(got) == 2 {
+				return
+			}
+		case <-timeout:
+			t.Fatal("watch tree timeout")
+		}
+	}
+}
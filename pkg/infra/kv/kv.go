@@ -0,0 +1,47 @@
+package kv
+
+import (
+	"time"
+
+	"github.com/docker/libkv"
+	"github.com/docker/libkv/store"
+	"github.com/docker/libkv/store/boltdb"
+	"github.com/docker/libkv/store/consul"
+	"github.com/docker/libkv/store/etcd"
+	"github.com/pkg/errors"
+)
+
+const (
+	// FILE 本地目录，一个 key 对应一个文件
+	FILE store.Backend = "file"
+
+	bucketName   = "config"
+	pollInterval = time.Second
+)
+
+func init() {
+	consul.Register()
+	etcd.Register()
+	boltdb.Register()
+	libkv.AddStore(FILE, NewFileStore)
+}
+
+// NewStore 按后端类型创建 kv 存储，各后端的 Watch/WatchTree 语义保持一致
+func NewStore(backend string, addrs []string) (store.Store, error) {
+	conf := &store.Config{ConnectionTimeout: 10 * time.Second}
+	if store.Backend(backend) == store.BOLTDB {
+		conf.Bucket = bucketName
+	}
+
+	kvStore, err := libkv.NewStore(store.Backend(backend), addrs, conf)
+	if err != nil {
+		return nil, errors.Wrapf(err, "new %s store", backend)
+	}
+
+	// boltdb 不支持 watch，通过轮询实现
+	if store.Backend(backend) == store.BOLTDB {
+		kvStore = &pollStore{Store: kvStore, interval: pollInterval}
+	}
+
+	return kvStore, nil
+}
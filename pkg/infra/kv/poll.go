@@ -0,0 +1,104 @@
+package kv
+
+import (
+	"bytes"
+	"time"
+
+	"github.com/docker/libkv/store"
+)
+
+// pollStore 为不支持 watch 的后端提供轮询实现
+type pollStore struct {
+	store.Store
+	interval time.Duration
+}
+
+func (s *pollStore) Watch(key string, stopCh <-chan struct{}) (<-chan *store.KVPair, error) {
+	watchCh := make(chan *store.KVPair)
+
+	go func() {
+		defer close(watchCh)
+
+		var last *store.KVPair
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+
+		for {
+			pair, err := s.Get(key)
+			if err == nil && !samePair(last, pair) {
+				last = pair
+				select {
+				case watchCh <- pair:
+				case <-stopCh:
+					return
+				}
+			}
+
+			select {
+			case <-ticker.C:
+			case <-stopCh:
+				return
+			}
+		}
+	}()
+
+	return watchCh, nil
+}
+
+func (s *pollStore) WatchTree(directory string, stopCh <-chan struct{}) (<-chan []*store.KVPair, error) {
+	watchCh := make(chan []*store.KVPair)
+
+	go func() {
+		defer close(watchCh)
+
+		var last []*store.KVPair
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+
+		for {
+			pairs, err := s.List(directory)
+			if err == store.ErrKeyNotFound {
+				pairs, err = nil, nil
+			}
+
+			if err == nil && !samePairs(last, pairs) {
+				last = pairs
+				select {
+				case watchCh <- pairs:
+				case <-stopCh:
+					return
+				}
+			}
+
+			select {
+			case <-ticker.C:
+			case <-stopCh:
+				return
+			}
+		}
+	}()
+
+	return watchCh, nil
+}
+
+func samePair(a, b *store.KVPair) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+
+	return a.Key == b.Key && a.LastIndex == b.LastIndex && bytes.Equal(a.Value, b.Value)
+}
+
+func samePairs(a, b []*store.KVPair) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if !samePair(a[i], b[i]) {
+			return false
+		}
+	}
+
+	return true
+}
@@ -4,6 +4,8 @@ import (
 	"context"
 	"time"
 
+	"template/pkg/infra/monitoring"
+
 	"github.com/pkg/errors"
 
 	"go.mongodb.org/mongo-driver/bson"
@@ -25,31 +27,74 @@ type Client interface {
 	UpsertOne(ctx context.Context, table string, filter interface{}, data interface{}) error
 	DeleteOne(ctx context.Context, table string, filter interface{}) error
 	DeleteAll(ctx context.Context, table string, filter interface{}) (int64, error)
+	InsertOne(ctx context.Context, table string, data interface{}) (interface{}, error)
+	InsertMany(ctx context.Context, table string, data []interface{}) ([]interface{}, error)
+	Count(ctx context.Context, table string, filter interface{}) (int64, error)
+	Distinct(ctx context.Context, table string, field string, filter interface{}) ([]interface{}, error)
+	Aggregate(ctx context.Context, table string, pipeline interface{}, data interface{}) error
+	FindWithOptions(ctx context.Context, table string, filter interface{}, opts *FindOptions, data interface{}) error
+	FindOneAndUpdate(ctx context.Context, table string, filter interface{}, update interface{}, opts *FindOneAndUpdateOptions, data interface{}) error
 
 	MultiReplaceInsert(ctx context.Context, table string, filter []interface{}, data []interface{}) error
 	RunJavascript(ctx context.Context, script string) ([]interface{}, error)
 	Traverse(ctx context.Context, table string, finder interface{}, data interface{}, projection interface{}, limit int64, fun TraverseFunc) error
-	Transaction(ctx context.Context, table string) error
-	Session(ctx context.Context, table string) error
+
+	// TraverseRange 按 _id 分段遍历，支持断点继续、并行和限速，用于修数据和回填
+	TraverseRange(ctx context.Context, table string, opts *TraverseOptions, fn DocFunc) error
+
+	// SplitBounds 按 _id 把集合大致均分为 n 段，返回的边界用于 TraverseOptions.Bounds
+	SplitBounds(ctx context.Context, table string, filter interface{}, n int) ([]interface{}, error)
+
+	// WithTransaction 在事务中执行 fn，需要副本集或分片集群
+	// fn 中使用 sessCtx 调用其他方法即可加入事务，遇到 TransientTransactionError 和
+	// UnknownTransactionCommitResult 时自动重试，fn 可能被执行多次
+	WithTransaction(ctx context.Context, opts *TxOptions, fn TxFunc) error
+
+	// Watch 监听集合或整个库的变更，需要副本集或分片集群
+	Watch(opts *WatchOptions) Watcher
+
+	// SyncIndexes 按代码中的声明检查和同步索引，返回差异
+	SyncIndexes(ctx context.Context, declared map[string][]Index, opts SyncIndexOptions) (*IndexReport, error)
+
+	// Collection 直接访问集合，用于没有封装的操作
+	Collection(table string) *mongo.Collection
+
+	PoolStats() map[string]monitoring.PoolStats
+	Close(ctx context.Context) error
 }
 
 type Config struct {
-	Hosts       []string
-	Database    string
-	UserName    string
-	Password    string
-	AuthSource  string
-	MaxPoolSize uint
-	MinPoolSize uint
-	MaxIdleTime uint
+	Hosts                  []string
+	Database               string
+	UserName               string
+	Password               string
+	AuthSource             string
+	MaxPoolSize            uint
+	MinPoolSize            uint
+	MaxIdleTime            uint // 秒
+	ConnectTimeout         time.Duration
+	SocketTimeout          time.Duration
+	ServerSelectionTimeout time.Duration
 }
 
 func NewClient(conf *Config) (Client, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 
+	socketTimeout := 10 * time.Second
+	if conf.SocketTimeout > 0 {
+		socketTimeout = conf.SocketTimeout
+	}
+
+	pool := newPoolStats(uint32(conf.MaxPoolSize))
 	opts := options.Client().SetMaxPoolSize(uint64(conf.MaxPoolSize)).SetMinPoolSize(uint64(conf.MinPoolSize)).
 		SetMaxConnIdleTime(time.Duration(conf.MaxIdleTime) * time.Second).SetHosts(conf.Hosts).
-		SetSocketTimeout(10 * time.Second)
+		SetSocketTimeout(socketTimeout).SetPoolMonitor(pool.monitor()).SetMonitor(newCommandMonitor().monitor())
+	if conf.ConnectTimeout > 0 {
+		opts = opts.SetConnectTimeout(conf.ConnectTimeout)
+	}
+	if conf.ServerSelectionTimeout > 0 {
+		opts = opts.SetServerSelectionTimeout(conf.ServerSelectionTimeout)
+	}
 	if conf.UserName != "" && conf.Password != "" {
 		opts = opts.SetAuth(options.Credential{
 			Username:   conf.UserName,
@@ -73,12 +118,23 @@ func NewClient(conf *Config) (Client, error) {
 	return &client{
 		cli:  cli,
 		conf: conf,
+		pool: pool,
 	}, nil
 }
 
 type client struct {
 	cli  *mongo.Client
 	conf *Config
+	pool *poolStats
+}
+
+func (c *client) PoolStats() map[string]monitoring.PoolStats {
+	return c.pool.stats()
+}
+
+// Close 断开所有连接
+func (c *client) Close(ctx context.Context) error {
+	return c.cli.Disconnect(ctx)
 }
 
 func (c *client) FindOne(ctx context.Context, table string, filter interface{}, data interface{}) error {
@@ -159,30 +215,19 @@ func (c *client) Traverse(ctx context.Context, table string, finder interface{},
 	if err != nil {
 		return err
 	}
+	defer cursor.Close(context.Background())
 
-	for cursor.TryNext(context.TODO()) {
-		select {
-		case <-ctx.Done():
-			return ctx.Err()
-		default:
-			err = cursor.Decode(data)
-			if err != nil {
-				return err
-			}
-
-			err := fun(data)
-			if err != nil {
-				return err
-			}
-
-			length := cursor.RemainingBatchLength()
-			if length == 0 {
-				time.Sleep(time.Millisecond * 100)
-			}
+	for cursor.Next(ctx) {
+		if err = cursor.Decode(data); err != nil {
+			return err
+		}
+
+		if err = fun(data); err != nil {
+			return err
 		}
 	}
 
-	return nil
+	return cursor.Err()
 }
 
 // MultiReplaceInsert ...
@@ -230,62 +275,3 @@ func (c *client) RunJavascript(ctx context.Context, script string) ([]interface{
 
 	return arr, nil
 }
-
-// Transaction ...
-func (c *client) Transaction(ctx context.Context, table string) error {
-	session, err := c.cli.StartSession()
-	if err != nil {
-		return err
-	}
-	defer session.EndSession(ctx)
-
-	// session 上下文来保证一个事务
-	sessCtx := mongo.NewSessionContext(ctx, session)
-
-	//开始事务
-	err = session.StartTransaction()
-	if err != nil {
-		return err
-	}
-
-	// 可以用多个表，保证事务执行
-	collection := session.Client().Database(c.conf.Database).Collection(table)
-
-	_, err = collection.InsertOne(sessCtx, bson.M{"_id": "222", "name": "ddd", "age": 50})
-	if err != nil {
-		return err
-	}
-
-	//写重复id
-	_, err = collection.InsertOne(sessCtx, bson.M{"_id": "111", "name": "ddd", "age": 50})
-	if err != nil {
-		_ = session.AbortTransaction(ctx)
-		return err
-	}
-
-	return session.CommitTransaction(ctx)
-}
-
-// Session 需要Replication Set才能执行
-func (c *client) Session(ctx context.Context, table string) error {
-	return c.cli.UseSession(ctx, func(sessionContext mongo.SessionContext) error {
-		err := sessionContext.StartTransaction()
-		if err != nil {
-			return err
-		}
-
-		col := sessionContext.Client().Database(c.conf.Database).Collection(table)
-		_, err = col.InsertOne(sessionContext, bson.M{"_id": "444", "name": "ddd", "age": 50})
-		if err != nil {
-			return err
-		}
-
-		_, err = col.InsertOne(sessionContext, bson.M{"_id": "111", "name": "ddd", "age": 50})
-		if err != nil {
-			_ = sessionContext.AbortTransaction(sessionContext)
-			return err
-		}
-
-		return sessionContext.CommitTransaction(sessionContext)
-	})
-}
@@ -0,0 +1,116 @@
+package mongo
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// FindOptions 查询选项，零值表示不设置
+type FindOptions struct {
+	Sort       interface{} // 例如 bson.D{{Key: "score", Value: -1}}
+	Skip       int64
+	Limit      int64
+	Projection interface{}
+}
+
+func (o *FindOptions) options() *options.FindOptions {
+	opts := options.Find()
+	if o == nil {
+		return opts
+	}
+
+	if o.Sort != nil {
+		opts.SetSort(o.Sort)
+	}
+	if o.Skip > 0 {
+		opts.SetSkip(o.Skip)
+	}
+	if o.Limit > 0 {
+		opts.SetLimit(o.Limit)
+	}
+	if o.Projection != nil {
+		opts.SetProjection(o.Projection)
+	}
+	return opts
+}
+
+// FindOneAndUpdateOptions 原子更新选项
+type FindOneAndUpdateOptions struct {
+	Upsert      bool
+	ReturnAfter bool // 返回更新后的文档，默认返回更新前的
+	Sort        interface{}
+	Projection  interface{}
+}
+
+func (o *FindOneAndUpdateOptions) options() *options.FindOneAndUpdateOptions {
+	opts := options.FindOneAndUpdate()
+	if o == nil {
+		return opts
+	}
+
+	opts.SetUpsert(o.Upsert)
+	if o.ReturnAfter {
+		opts.SetReturnDocument(options.After)
+	}
+	if o.Sort != nil {
+		opts.SetSort(o.Sort)
+	}
+	if o.Projection != nil {
+		opts.SetProjection(o.Projection)
+	}
+	return opts
+}
+
+// InsertOne 返回插入的 _id
+func (c *client) InsertOne(ctx context.Context, table string, data interface{}) (interface{}, error) {
+	result, err := c.Collection(table).InsertOne(ctx, data)
+	if err != nil {
+		return nil, err
+	}
+
+	return result.InsertedID, nil
+}
+
+// InsertMany 按顺序插入，遇到错误停止，返回已插入的 _id
+func (c *client) InsertMany(ctx context.Context, table string, data []interface{}) ([]interface{}, error) {
+	result, err := c.Collection(table).InsertMany(ctx, data)
+	if result != nil {
+		return result.InsertedIDs, err
+	}
+
+	return nil, err
+}
+
+func (c *client) Count(ctx context.Context, table string, filter interface{}) (int64, error) {
+	return c.Collection(table).CountDocuments(ctx, filter)
+}
+
+func (c *client) Distinct(ctx context.Context, table string, field string, filter interface{}) ([]interface{}, error) {
+	return c.Collection(table).Distinct(ctx, field, filter)
+}
+
+// Aggregate 结果解码到 data，data 为切片的指针
+func (c *client) Aggregate(ctx context.Context, table string, pipeline interface{}, data interface{}) error {
+	cursor, err := c.Collection(table).Aggregate(ctx, pipeline)
+	if err != nil {
+		return err
+	}
+
+	return cursor.All(ctx, data)
+}
+
+func (c *client) FindWithOptions(ctx context.Context, table string, filter interface{}, opts *FindOptions, data interface{}) error {
+	cursor, err := c.Collection(table).Find(ctx, filter, opts.options())
+	if err != nil {
+		return err
+	}
+
+	return cursor.All(ctx, data)
+}
+
+// FindOneAndUpdate 原子地更新并返回文档，可用于计数器
+func (c *client) FindOneAndUpdate(ctx context.Context, table string, filter interface{}, update interface{},
+	opts *FindOneAndUpdateOptions, data interface{}) error {
+	return c.Collection(table).FindOneAndUpdate(ctx, filter, update, opts.options()).Decode(data)
+}
@@ -0,0 +1,230 @@
+package mongo
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Index 在代码中声明的索引，Name 为空时与驱动的默认名一致，例如 uid_1_level_-1
+type Index struct {
+	Name    string
+	Keys    bson.D
+	Unique  bool
+	TTL     time.Duration // 大于 0 时为 TTL 索引，只能有一个字段
+	Partial interface{}   // partialFilterExpression
+}
+
+func (i *Index) name() string {
+	if i.Name != "" {
+		return i.Name
+	}
+
+	parts := make([]string, 0, len(i.Keys)*2)
+	for _, e := range i.Keys {
+		parts = append(parts, e.Key, fmt.Sprint(e.Value))
+	}
+	return strings.Join(parts, "_")
+}
+
+func (i *Index) model() mongo.IndexModel {
+	opts := options.Index().SetName(i.name())
+	if i.Unique {
+		opts.SetUnique(true)
+	}
+	if i.TTL > 0 {
+		opts.SetExpireAfterSeconds(int32(i.TTL / time.Second))
+	}
+	if i.Partial != nil {
+		opts.SetPartialFilterExpression(i.Partial)
+	}
+	return mongo.IndexModel{Keys: i.Keys, Options: opts}
+}
+
+// existingIndex listIndexes 返回的索引
+type existingIndex struct {
+	Name    string   `bson:"name"`
+	Key     bson.D   `bson:"key"`
+	Unique  bool     `bson:"unique"`
+	TTL     *int32   `bson:"expireAfterSeconds"`
+	Partial bson.Raw `bson:"partialFilterExpression"`
+}
+
+// same 比较索引定义，数字类型统一后再比较
+func (e *existingIndex) same(i *Index) (bool, error) {
+	if normalizeKeys(e.Key) != normalizeKeys(i.Keys) || e.Unique != i.Unique {
+		return false, nil
+	}
+
+	ttl := int32(-1)
+	if e.TTL != nil {
+		ttl = *e.TTL
+	}
+	want := int32(-1)
+	if i.TTL > 0 {
+		want = int32(i.TTL / time.Second)
+	}
+	if ttl != want {
+		return false, nil
+	}
+
+	if i.Partial == nil || e.Partial == nil {
+		return i.Partial == nil && e.Partial == nil, nil
+	}
+
+	a, err := looseJSON(i.Partial)
+	if err != nil {
+		return false, err
+	}
+	b, err := looseJSON(e.Partial)
+	if err != nil {
+		return false, err
+	}
+	return reflect.DeepEqual(a, b), nil
+}
+
+// looseJSON 转成不区分数字类型和字段顺序的结构，用于比较
+func looseJSON(v interface{}) (interface{}, error) {
+	data, err := bson.MarshalExtJSON(v, false, false)
+	if err != nil {
+		return nil, err
+	}
+
+	var result interface{}
+	err = json.Unmarshal(data, &result)
+	return result, err
+}
+
+func normalizeKeys(keys bson.D) string {
+	parts := make([]string, 0, len(keys))
+	for _, e := range keys {
+		value := fmt.Sprint(e.Value)
+		switch v := e.Value.(type) {
+		case float64:
+			value = fmt.Sprint(int64(v))
+		case float32:
+			value = fmt.Sprint(int64(v))
+		}
+		parts = append(parts, e.Key+":"+value)
+	}
+	return strings.Join(parts, ",")
+}
+
+// SyncIndexOptions 默认只检查不修改
+type SyncIndexOptions struct {
+	Create bool // 创建缺少的索引
+	Drop   bool // 删除多余的索引，定义不一致的索引删除后重建，同时会创建缺少的索引
+}
+
+// IndexReport 索引的差异，元素为 集合.索引名
+type IndexReport struct {
+	Missing    []string
+	Extra      []string
+	Mismatched []string
+	Created    []string
+	Dropped    []string
+}
+
+// SyncIndexes 按声明同步索引，declared 的 key 为集合名
+func (c *client) SyncIndexes(ctx context.Context, declared map[string][]Index, opts SyncIndexOptions) (*IndexReport, error) {
+	report := &IndexReport{}
+
+	tables := make([]string, 0, len(declared))
+	for table := range declared {
+		tables = append(tables, table)
+	}
+	sort.Strings(tables)
+
+	for _, table := range tables {
+		if err := c.syncIndexes(ctx, table, declared[table], opts, report); err != nil {
+			return report, errors.Wrapf(err, "sync indexes of %v", table)
+		}
+	}
+
+	return report, nil
+}
+
+func (c *client) syncIndexes(ctx context.Context, table string, indexes []Index, opts SyncIndexOptions, report *IndexReport) error {
+	view := c.Collection(table).Indexes()
+	cursor, err := view.List(ctx)
+	if err != nil {
+		return err
+	}
+
+	existing := make([]existingIndex, 0)
+	if err = cursor.All(ctx, &existing); err != nil {
+		return err
+	}
+
+	byName := make(map[string]*existingIndex, len(existing))
+	for i := range existing {
+		byName[existing[i].Name] = &existing[i]
+	}
+
+	declared := make(map[string]bool, len(indexes))
+	create := make([]mongo.IndexModel, 0)
+	for i := range indexes {
+		index := &indexes[i]
+		name := index.name()
+		declared[name] = true
+		full := table + "." + name
+
+		current, ok := byName[name]
+		if !ok {
+			report.Missing = append(report.Missing, full)
+			create = append(create, index.model())
+			continue
+		}
+
+		same, err := current.same(index)
+		if err != nil {
+			return err
+		}
+		if same {
+			continue
+		}
+
+		report.Mismatched = append(report.Mismatched, full)
+		if opts.Drop {
+			if _, err = view.DropOne(ctx, name); err != nil {
+				return errors.Wrapf(err, "drop %v", name)
+			}
+			report.Dropped = append(report.Dropped, full)
+			create = append(create, index.model())
+		}
+	}
+
+	for _, index := range existing {
+		if index.Name == "_id_" || declared[index.Name] {
+			continue
+		}
+
+		full := table + "." + index.Name
+		report.Extra = append(report.Extra, full)
+		if opts.Drop {
+			if _, err = view.DropOne(ctx, index.Name); err != nil {
+				return errors.Wrapf(err, "drop %v", index.Name)
+			}
+			report.Dropped = append(report.Dropped, full)
+		}
+	}
+
+	if !opts.Create && !opts.Drop || len(create) == 0 {
+		return nil
+	}
+
+	names, err := view.CreateMany(ctx, create)
+	for _, name := range names {
+		report.Created = append(report.Created, table+"."+name)
+	}
+	return err
+}
@@ -0,0 +1,38 @@
+package mongo
+
+import (
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestIndexSame(t *testing.T) {
+	ttl := int32(3600)
+	declared := &Index{
+		Keys:    bson.D{{Key: "uid", Value: 1}, {Key: "level", Value: -1}},
+		TTL:     time.Hour,
+		Partial: bson.M{"level": bson.M{"$gt": 10}, "vip": true},
+	}
+
+	if name := declared.name(); name != "uid_1_level_-1" {
+		t.Fatalf("unexpected default name %v", name)
+	}
+
+	partial, _ := bson.Marshal(bson.D{{Key: "vip", Value: true}, {Key: "level", Value: bson.D{{Key: "$gt", Value: 10.0}}}})
+	existing := &existingIndex{
+		Name:    "uid_1_level_-1",
+		Key:     bson.D{{Key: "uid", Value: int32(1)}, {Key: "level", Value: float64(-1)}},
+		TTL:     &ttl,
+		Partial: partial,
+	}
+
+	if same, err := existing.same(declared); err != nil || !same {
+		t.Fatalf("expect same index, got %v %v", same, err)
+	}
+
+	declared.Unique = true
+	if same, _ := existing.same(declared); same {
+		t.Fatal("expect unique mismatch")
+	}
+}
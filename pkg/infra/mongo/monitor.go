@@ -0,0 +1,106 @@
+package mongo
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	"template/pkg/infra/monitoring"
+
+	"go.mongodb.org/mongo-driver/event"
+	"go.opencensus.io/trace"
+)
+
+// ignoredCommands 认证相关的命令不记录
+var ignoredCommands = map[string]bool{
+	"saslStart":    true,
+	"saslContinue": true,
+	"authenticate": true,
+	"getnonce":     true,
+}
+
+// commandMonitor 按命令和集合记录耗时，并为每个命令创建 span
+type commandMonitor struct {
+	sync.Mutex
+	pending map[int64]*pendingCommand
+}
+
+type pendingCommand struct {
+	span *trace.Span
+	stat func(err error)
+}
+
+func newCommandMonitor() *commandMonitor {
+	return &commandMonitor{pending: make(map[int64]*pendingCommand)}
+}
+
+func (m *commandMonitor) monitor() *event.CommandMonitor {
+	return &event.CommandMonitor{
+		Started:   m.started,
+		Succeeded: m.succeeded,
+		Failed:    m.failed,
+	}
+}
+
+func (m *commandMonitor) started(ctx context.Context, e *event.CommandStartedEvent) {
+	if ignoredCommands[e.CommandName] {
+		return
+	}
+
+	// 大部分命令的第一个字段是集合名
+	collection, _ := e.Command.Index(0).Value().StringValueOK()
+	instance := connInstance(e.ConnectionID)
+
+	_, span := trace.StartSpan(ctx, "mongo."+e.CommandName, trace.WithSpanKind(trace.SpanKindClient))
+	span.AddAttributes(
+		trace.StringAttribute("db.system", "mongodb"),
+		trace.StringAttribute("db.name", e.DatabaseName),
+		trace.StringAttribute("db.mongodb.collection", collection),
+		trace.StringAttribute("net.peer.name", instance),
+	)
+
+	m.Lock()
+	defer m.Unlock()
+	m.pending[e.RequestID] = &pendingCommand{
+		span: span,
+		stat: monitoring.GetRecordMongoCallStatsHandler(e.CommandName, collection, instance),
+	}
+}
+
+func (m *commandMonitor) finish(requestID int64, err error, failure string) {
+	m.Lock()
+	cmd, ok := m.pending[requestID]
+	delete(m.pending, requestID)
+	m.Unlock()
+	if !ok {
+		return
+	}
+
+	cmd.stat(err)
+	if err != nil {
+		cmd.span.SetStatus(trace.Status{Code: trace.StatusCodeUnknown, Message: failure})
+	}
+	cmd.span.End()
+}
+
+func (m *commandMonitor) succeeded(_ context.Context, e *event.CommandSucceededEvent) {
+	m.finish(e.RequestID, nil, "")
+}
+
+func (m *commandMonitor) failed(_ context.Context, e *event.CommandFailedEvent) {
+	m.finish(e.RequestID, commandError(e.Failure), e.Failure)
+}
+
+// connInstance ConnectionID 的格式为 host:port[-n]，去掉连接编号避免标签过多
+func connInstance(id string) string {
+	if i := strings.LastIndex(id, "["); i > 0 {
+		return id[:i]
+	}
+	return id
+}
+
+type commandError string
+
+func (e commandError) Error() string {
+	return string(e)
+}
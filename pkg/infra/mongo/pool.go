@@ -0,0 +1,87 @@
+package mongo
+
+import (
+	"sync"
+
+	"template/pkg/infra/monitoring"
+
+	"go.mongodb.org/mongo-driver/event"
+)
+
+// poolStats 驱动没有提供连接池状态，通过 PoolMonitor 事件统计各个节点的连接数
+type poolStats struct {
+	sync.Mutex
+	maxConns uint32
+	nodes    map[string]*nodeStats
+}
+
+type nodeStats struct {
+	total    int64
+	inUse    int64
+	waits    uint64
+	timeouts uint64
+}
+
+func newPoolStats(maxConns uint32) *poolStats {
+	return &poolStats{maxConns: maxConns, nodes: make(map[string]*nodeStats)}
+}
+
+func (p *poolStats) monitor() *event.PoolMonitor {
+	return &event.PoolMonitor{Event: p.onEvent}
+}
+
+func (p *poolStats) onEvent(e *event.PoolEvent) {
+	p.Lock()
+	defer p.Unlock()
+
+	node, ok := p.nodes[e.Address]
+	if !ok {
+		node = &nodeStats{}
+		p.nodes[e.Address] = node
+	}
+
+	switch e.Type {
+	case event.ConnectionCreated:
+		node.total++
+	case event.ConnectionClosed:
+		node.total--
+	case event.GetStarted:
+		node.waits++
+		monitoring.RecordMongoCheckoutStart(e.Address)
+	case event.GetSucceeded:
+		node.inUse++
+		monitoring.RecordMongoCheckoutDone(e.Address, "OK")
+	case event.ConnectionReturned:
+		node.inUse--
+	case event.GetFailed:
+		if e.Reason == event.ReasonTimedOut {
+			node.timeouts++
+		}
+		monitoring.RecordMongoCheckoutDone(e.Address, e.Reason)
+	case event.PoolClosedEvent:
+		delete(p.nodes, e.Address)
+	}
+}
+
+func (p *poolStats) stats() map[string]monitoring.PoolStats {
+	p.Lock()
+	defer p.Unlock()
+
+	result := make(map[string]monitoring.PoolStats, len(p.nodes))
+	for addr, node := range p.nodes {
+		idle := node.total - node.inUse
+		if idle < 0 {
+			idle = 0
+		}
+
+		result[addr] = monitoring.PoolStats{
+			MaxConns:   p.maxConns,
+			TotalConns: uint32(node.total),
+			IdleConns:  uint32(idle),
+			WaitCount:  node.waits,
+			Timeouts:   node.timeouts,
+		}
+	}
+
+	return result
+}
@@ -0,0 +1,293 @@
+package mongo
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"time"
+
+	"template/pkg/infra/monitoring"
+
+	"github.com/juju/ratelimit"
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"golang.org/x/sync/errgroup"
+)
+
+const defaultBatchSize = 200
+
+// DocFunc 处理一个文档，raw 每次都是新的，可以在 fn 返回后继续使用
+type DocFunc func(ctx context.Context, raw bson.Raw) error
+
+// Checkpoint 分段最后处理的 _id 和保存时分段的上下界
+type Checkpoint struct {
+	LastID bson.RawValue
+	Bounds bson.Raw
+}
+
+// CheckpointStore 保存每个分段的进度，用于中断后继续
+type CheckpointStore interface {
+	// Load 没有进度时 ok 为 false
+	Load(ctx context.Context, key string) (cp Checkpoint, ok bool, err error)
+	Save(ctx context.Context, key string, cp Checkpoint) error
+}
+
+// TraverseOptions 按 _id 升序遍历，Bounds 把 _id 分成多段并行处理
+type TraverseOptions struct {
+	Job        string          // 任务名，用于进度的 key 和监控
+	Checkpoint CheckpointStore // 为空时不保存进度
+	Filter     interface{}
+	Projection interface{}
+
+	Bounds          []interface{} // n 个递增的 _id 边界分成 n+1 段，可以用 SplitBounds 生成
+	Workers         int           // 同时处理的分段数，默认 1
+	BatchSize       int32         // 默认 200
+	Rate            float64       // 每秒最多处理的文档数，0 不限制
+	CheckpointEvery int           // 每处理多少个文档保存一次进度，默认 BatchSize
+}
+
+type segment struct {
+	index        int
+	lower, upper interface{} // nil 表示没有边界
+}
+
+func (o *TraverseOptions) segments() []segment {
+	segments := make([]segment, 0, len(o.Bounds)+1)
+	var lower interface{}
+	for i, bound := range o.Bounds {
+		segments = append(segments, segment{index: i, lower: lower, upper: bound})
+		lower = bound
+	}
+	return append(segments, segment{index: len(o.Bounds), lower: lower})
+}
+
+// bounds 编码分段的上下界，进度只能在相同边界的分段上继续
+func (s segment) bounds() bson.Raw {
+	raw, _ := bson.Marshal(bson.D{{Key: "lower", Value: s.lower}, {Key: "upper", Value: s.upper}})
+	return raw
+}
+
+// resume 读取分段的进度，Bounds 变化后分段的编号对应不同的范围，旧进度不能使用
+func (s segment) resume(ctx context.Context, store CheckpointStore, key string) (*bson.RawValue, error) {
+	if store == nil {
+		return nil, nil
+	}
+
+	cp, ok, err := store.Load(ctx, key)
+	if err != nil {
+		return nil, errors.Wrap(err, "load checkpoint")
+	}
+	if !ok {
+		return nil, nil
+	}
+	if !bytes.Equal(cp.Bounds, s.bounds()) {
+		return nil, errors.Errorf("checkpoint %v was saved with bounds %v, now %v", key, cp.Bounds, s.bounds())
+	}
+	return &cp.LastID, nil
+}
+
+func (s segment) filter(filter interface{}, after *bson.RawValue) bson.D {
+	idRange := bson.D{}
+	if after != nil {
+		idRange = append(idRange, bson.E{Key: "$gt", Value: *after})
+	} else if s.lower != nil {
+		idRange = append(idRange, bson.E{Key: "$gte", Value: s.lower})
+	}
+	if s.upper != nil {
+		idRange = append(idRange, bson.E{Key: "$lt", Value: s.upper})
+	}
+
+	conditions := bson.A{}
+	if filter != nil {
+		conditions = append(conditions, filter)
+	}
+	if len(idRange) > 0 {
+		conditions = append(conditions, bson.D{{Key: "_id", Value: idRange}})
+	}
+
+	if len(conditions) == 0 {
+		return bson.D{}
+	}
+	return bson.D{{Key: "$and", Value: conditions}}
+}
+
+// TraverseRange 分段遍历集合，任何一段出错时停止所有分段并返回错误
+// 从进度继续时，上次保存进度之后处理过的文档会再处理一次，fn 需要幂等
+func (c *client) TraverseRange(ctx context.Context, table string, opts *TraverseOptions, fn DocFunc) error {
+	if opts == nil {
+		opts = &TraverseOptions{}
+	}
+
+	workers := opts.Workers
+	if workers <= 0 {
+		workers = 1
+	}
+
+	var bucket *ratelimit.Bucket
+	if opts.Rate > 0 {
+		bucket = ratelimit.NewBucketWithRate(opts.Rate, int64(opts.Rate)+1)
+	}
+
+	g, ctx := errgroup.WithContext(ctx)
+	sem := make(chan struct{}, workers)
+	for _, seg := range opts.segments() {
+		seg := seg
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			return g.Wait()
+		}
+
+		g.Go(func() error {
+			defer func() { <-sem }()
+			err := c.traverseSegment(ctx, table, opts, seg, bucket, fn)
+			monitoring.RecordTraverseSegment(opts.Job, err)
+			return errors.Wrapf(err, "segment %v", seg.index)
+		})
+	}
+
+	return g.Wait()
+}
+
+func (c *client) traverseSegment(ctx context.Context, table string, opts *TraverseOptions, seg segment,
+	bucket *ratelimit.Bucket, fn DocFunc) (err error) {
+	key := fmt.Sprintf("%s/%d", opts.Job, seg.index)
+	after, err := seg.resume(ctx, opts.Checkpoint, key)
+	if err != nil {
+		return err
+	}
+
+	batchSize := opts.BatchSize
+	if batchSize <= 0 {
+		batchSize = defaultBatchSize
+	}
+
+	every := opts.CheckpointEvery
+	if every <= 0 {
+		every = int(batchSize)
+	}
+
+	findOpts := options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}).SetBatchSize(batchSize)
+	if opts.Projection != nil {
+		findOpts.SetProjection(opts.Projection)
+	}
+
+	cursor, err := c.Collection(table).Find(ctx, seg.filter(opts.Filter, after), findOpts)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(context.Background())
+
+	var lastID bson.RawValue
+	pending := 0
+	save := func() error {
+		monitoring.RecordTraverseDocs(opts.Job, pending, nil)
+		if opts.Checkpoint == nil || pending == 0 {
+			pending = 0
+			return nil
+		}
+
+		pending = 0
+		return errors.Wrap(opts.Checkpoint.Save(ctx, key, Checkpoint{LastID: lastID, Bounds: seg.bounds()}), "save checkpoint")
+	}
+
+	for cursor.Next(ctx) {
+		if bucket != nil {
+			select {
+			case <-time.After(bucket.Take(1)):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+
+		raw := make(bson.Raw, len(cursor.Current))
+		copy(raw, cursor.Current)
+		if err = fn(ctx, raw); err != nil {
+			monitoring.RecordTraverseDocs(opts.Job, 1, err)
+			// 保存已经成功的进度
+			if e := save(); e != nil {
+				return errors.Wrapf(err, "%v", e)
+			}
+			return err
+		}
+
+		lastID = raw.Lookup("_id")
+		if pending++; pending >= every {
+			if err = save(); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err = cursor.Err(); err != nil {
+		return err
+	}
+
+	return save()
+}
+
+// SplitBounds 用 $bucketAuto 按 _id 把集合大致均分为 n 段，返回 n-1 个边界
+func (c *client) SplitBounds(ctx context.Context, table string, filter interface{}, n int) ([]interface{}, error) {
+	if n <= 1 {
+		return nil, nil
+	}
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$bucketAuto", Value: bson.D{{Key: "groupBy", Value: "$_id"}, {Key: "buckets", Value: n}}}},
+	}
+	if filter != nil {
+		pipeline = append(mongo.Pipeline{{{Key: "$match", Value: filter}}}, pipeline...)
+	}
+
+	buckets := make([]struct {
+		ID struct {
+			Min interface{} `bson:"min"`
+		} `bson:"_id"`
+	}, 0, n)
+	if err := c.Aggregate(ctx, table, pipeline, &buckets); err != nil {
+		return nil, err
+	}
+
+	bounds := make([]interface{}, 0, len(buckets))
+	for i := 1; i < len(buckets); i++ {
+		bounds = append(bounds, buckets[i].ID.Min)
+	}
+	return bounds, nil
+}
+
+// NewCollectionCheckpoint 进度保存在 mongo 的集合中，一个分段一个文档
+func NewCollectionCheckpoint(cli Client, table string) CheckpointStore {
+	return &collectionCheckpoint{cli: cli, table: table}
+}
+
+type collectionCheckpoint struct {
+	cli   Client
+	table string
+}
+
+func (c *collectionCheckpoint) Load(ctx context.Context, key string) (Checkpoint, bool, error) {
+	doc := bson.Raw{}
+	err := c.cli.Collection(c.table).FindOne(ctx, bson.M{"_id": key}).Decode(&doc)
+	if err == mongo.ErrNoDocuments {
+		return Checkpoint{}, false, nil
+	}
+	if err != nil {
+		return Checkpoint{}, false, err
+	}
+
+	// 没有 bounds 的旧进度按边界不一致处理
+	cp := Checkpoint{LastID: doc.Lookup("lastId")}
+	if bounds, ok := doc.Lookup("bounds").DocumentOK(); ok {
+		cp.Bounds = bounds
+	}
+	return cp, true, nil
+}
+
+func (c *collectionCheckpoint) Save(ctx context.Context, key string, cp Checkpoint) error {
+	_, err := c.cli.Collection(c.table).UpdateOne(ctx, bson.M{"_id": key},
+		bson.M{"$set": bson.M{"lastId": cp.LastID, "bounds": cp.Bounds, "updatedAt": time.Now()}},
+		options.Update().SetUpsert(true))
+	return err
+}
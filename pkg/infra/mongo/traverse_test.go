@@ -0,0 +1,72 @@
+package mongo
+
+import (
+	"context"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestSegments(t *testing.T) {
+	opts := &TraverseOptions{Bounds: []interface{}{100, 200}}
+	segments := opts.segments()
+	if len(segments) != 3 || segments[0].lower != nil || segments[1].lower != 100 || segments[2].upper != nil {
+		t.Fatalf("unexpected segments %+v", segments)
+	}
+
+	filter := segments[1].filter(bson.M{"level": 1}, nil)
+	expect := bson.D{{Key: "$and", Value: bson.A{
+		bson.M{"level": 1},
+		bson.D{{Key: "_id", Value: bson.D{{Key: "$gte", Value: 100}, {Key: "$lt", Value: 200}}}},
+	}}}
+
+	got, _ := bson.MarshalExtJSON(filter, false, false)
+	want, _ := bson.MarshalExtJSON(expect, false, false)
+	if string(got) != string(want) {
+		t.Fatalf("unexpected filter %s", got)
+	}
+
+	_, value, _ := bson.MarshalValue(150)
+	after := bson.RawValue{Type: bson.TypeInt32, Value: value}
+	got, _ = bson.MarshalExtJSON(segments[1].filter(nil, &after), false, false)
+	if string(got) != `{"$and":[{"_id":{"$gt":150,"$lt":200}}]}` {
+		t.Fatalf("unexpected resume filter %s", got)
+	}
+}
+
+type memCheckpoint map[string]Checkpoint
+
+func (m memCheckpoint) Load(_ context.Context, key string) (Checkpoint, bool, error) {
+	cp, ok := m[key]
+	return cp, ok, nil
+}
+
+func (m memCheckpoint) Save(_ context.Context, key string, cp Checkpoint) error {
+	m[key] = cp
+	return nil
+}
+
+func TestResumeBounds(t *testing.T) {
+	ctx := context.Background()
+	store := memCheckpoint{}
+	seg := (&TraverseOptions{Bounds: []interface{}{100, 200}}).segments()[1]
+
+	_, value, _ := bson.MarshalValue(150)
+	lastID := bson.RawValue{Type: bson.TypeInt32, Value: value}
+	_ = store.Save(ctx, "job/1", Checkpoint{LastID: lastID, Bounds: seg.bounds()})
+
+	after, err := seg.resume(ctx, store, "job/1")
+	if err != nil || after == nil || after.Int32() != 150 {
+		t.Fatalf("unexpected resume %v %v", after, err)
+	}
+
+	// 重新切分后分段 1 的范围变了，旧进度会跳过 [100, 150] 中新的文档
+	moved := (&TraverseOptions{Bounds: []interface{}{50, 200}}).segments()[1]
+	if _, err = moved.resume(ctx, store, "job/1"); err == nil {
+		t.Fatal("expect bounds mismatch")
+	}
+
+	if after, err = moved.resume(ctx, store, "job/2"); err != nil || after != nil {
+		t.Fatalf("expect no checkpoint, got %v %v", after, err)
+	}
+}
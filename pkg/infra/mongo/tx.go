@@ -0,0 +1,77 @@
+package mongo
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readconcern"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+	"go.mongodb.org/mongo-driver/mongo/writeconcern"
+)
+
+// TxFunc 返回错误时回滚
+type TxFunc func(sessCtx mongo.SessionContext) error
+
+// TxOptions 事务选项，为空时使用客户端的默认值
+type TxOptions struct {
+	ReadConcern   string        // local、majority、snapshot
+	WriteConcern  string        // majority 或节点个数，例如 "1"
+	MaxCommitTime time.Duration // 提交的最长等待时间
+}
+
+func (o *TxOptions) options() (*options.TransactionOptions, error) {
+	// 事务只能读主节点
+	opts := options.Transaction().SetReadPreference(readpref.Primary())
+	if o == nil {
+		return opts, nil
+	}
+
+	if o.ReadConcern != "" {
+		opts.SetReadConcern(readconcern.New(readconcern.Level(o.ReadConcern)))
+	}
+
+	switch o.WriteConcern {
+	case "":
+	case "majority":
+		opts.SetWriteConcern(writeconcern.New(writeconcern.WMajority()))
+	default:
+		w, err := strconv.Atoi(o.WriteConcern)
+		if err != nil {
+			return nil, errors.Errorf("invalid write concern '%v'", o.WriteConcern)
+		}
+		opts.SetWriteConcern(writeconcern.New(writeconcern.W(w)))
+	}
+
+	if o.MaxCommitTime > 0 {
+		opts.SetMaxCommitTime(&o.MaxCommitTime)
+	}
+
+	return opts, nil
+}
+
+// WithTransaction 重试由驱动完成，总时长不超过 120 秒或 ctx 的超时
+func (c *client) WithTransaction(ctx context.Context, opts *TxOptions, fn TxFunc) error {
+	txOpts, err := opts.options()
+	if err != nil {
+		return err
+	}
+
+	session, err := c.cli.StartSession()
+	if err != nil {
+		return errors.Wrap(err, "start session")
+	}
+	defer session.EndSession(context.Background())
+
+	_, err = session.WithTransaction(ctx, func(sessCtx mongo.SessionContext) (interface{}, error) {
+		return nil, fn(sessCtx)
+	}, txOpts)
+	return err
+}
+
+func (c *client) Collection(table string) *mongo.Collection {
+	return c.cli.Database(c.conf.Database).Collection(table)
+}
@@ -0,0 +1,278 @@
+package mongo
+
+import (
+	"bytes"
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	minRetryInterval = 100 * time.Millisecond
+	maxRetryInterval = 30 * time.Second
+)
+
+// ChangeEvent 变更事件，FullDocument 只有在 WatchOptions.FullDocument 为 true 或插入、替换时才有
+type ChangeEvent struct {
+	OperationType string   `bson:"operationType"`
+	DocumentKey   bson.Raw `bson:"documentKey"`
+	FullDocument  bson.Raw `bson:"fullDocument"`
+	Ns            struct {
+		DB   string `bson:"db"`
+		Coll string `bson:"coll"`
+	} `bson:"ns"`
+	UpdateDescription bson.Raw            `bson:"updateDescription"`
+	ClusterTime       primitive.Timestamp `bson:"clusterTime"`
+}
+
+// ChangeHandler 返回错误时重试同一个事件，直到成功或停止，handler 需要幂等
+type ChangeHandler func(ctx context.Context, event *ChangeEvent) error
+
+// ResumeTokenStore 保存 resume token，重启后从上次处理完的事件继续
+type ResumeTokenStore interface {
+	// Load 没有保存时返回 nil
+	Load(ctx context.Context, name string) (bson.Raw, error)
+	Save(ctx context.Context, name string, token bson.Raw) error
+}
+
+// WatchOptions Table 为空时监听整个库
+type WatchOptions struct {
+	Name         string // 监听者名字，用于保存 resume token
+	Table        string
+	Pipeline     interface{} // 过滤事件，例如 mongo.Pipeline{{{"$match", bson.M{"operationType": "update"}}}}
+	FullDocument bool        // 更新事件也带上完整文档
+	Tokens       ResumeTokenStore
+}
+
+// Watcher 先注册 handler 再 Run，事件按顺序交给每一个 handler，至少投递一次
+type Watcher interface {
+	Handle(handler ChangeHandler)
+	// Run 阻塞到 ctx 结束，连接断开时自动从上次的位置重连
+	Run(ctx context.Context) error
+}
+
+func (c *client) Watch(opts *WatchOptions) Watcher {
+	w := &watcher{cli: c, opts: opts}
+	w.open = w.openStream
+	return w
+}
+
+// changeStream *mongo.ChangeStream 中用到的方法
+type changeStream interface {
+	TryNext(ctx context.Context) bool
+	Decode(val interface{}) error
+	ResumeToken() bson.Raw
+	Err() error
+	Close(ctx context.Context) error
+}
+
+type watcher struct {
+	sync.Mutex
+	cli      *client
+	opts     *WatchOptions
+	open     func(ctx context.Context) (changeStream, error)
+	handlers []ChangeHandler
+	token    bson.Raw
+}
+
+func (w *watcher) Handle(handler ChangeHandler) {
+	w.Lock()
+	defer w.Unlock()
+	w.handlers = append(w.handlers, handler)
+}
+
+func (w *watcher) Run(ctx context.Context) error {
+	if w.opts.Tokens != nil {
+		token, err := w.opts.Tokens.Load(ctx, w.opts.Name)
+		if err != nil {
+			return errors.Wrap(err, "load resume token")
+		}
+		w.token = token
+	}
+
+	retry := 0
+	for {
+		begin := time.Now()
+		err := w.watch(ctx)
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		// 正常运行过一段时间后断开，重新计算退避时间
+		if time.Since(begin) > maxRetryInterval {
+			retry = 0
+		}
+
+		if isResumeLost(err) {
+			// oplog 已经覆盖了 token 的位置，只能从当前开始，期间的事件会丢失
+			log.Error().Err(err).Str("watcher", w.opts.Name).Msg("resume token lost, watch from now")
+			w.token = nil
+		} else {
+			log.Warn().Err(err).Str("watcher", w.opts.Name).Msg("change stream broken, reconnecting")
+		}
+
+		if !sleep(ctx, backoff(retry)) {
+			return nil
+		}
+		retry++
+	}
+}
+
+func (w *watcher) openStream(ctx context.Context) (changeStream, error) {
+	streamOpts := options.ChangeStream()
+	if w.opts.FullDocument {
+		streamOpts.SetFullDocument(options.UpdateLookup)
+	}
+	if w.token != nil {
+		streamOpts.SetResumeAfter(w.token)
+	}
+
+	pipeline := w.opts.Pipeline
+	if pipeline == nil {
+		pipeline = mongo.Pipeline{}
+	}
+
+	db := w.cli.cli.Database(w.cli.conf.Database)
+	if w.opts.Table == "" {
+		return db.Watch(ctx, pipeline, streamOpts)
+	}
+	return db.Collection(w.opts.Table).Watch(ctx, pipeline, streamOpts)
+}
+
+func (w *watcher) watch(ctx context.Context) error {
+	stream, err := w.open(ctx)
+	if err != nil {
+		return err
+	}
+	defer stream.Close(context.Background())
+
+	for {
+		if stream.TryNext(ctx) {
+			event := &ChangeEvent{}
+			if err = stream.Decode(event); err != nil {
+				return errors.Wrap(err, "decode change event")
+			}
+
+			if err = w.dispatch(ctx, event); err != nil {
+				return err
+			}
+
+			w.record(ctx, stream.ResumeToken())
+			continue
+		}
+
+		if err = stream.Err(); err != nil {
+			return err
+		}
+		if err = ctx.Err(); err != nil {
+			return err
+		}
+
+		// 这一批没有事件，记录 post batch resume token，长时间没有匹配的事件时 token 也会前进，
+		// 避免重连时 token 已经被 oplog 覆盖
+		w.record(ctx, stream.ResumeToken())
+	}
+}
+
+// record token 变化时才保存
+func (w *watcher) record(ctx context.Context, token bson.Raw) {
+	if token == nil || bytes.Equal(token, w.token) {
+		return
+	}
+
+	w.token = token
+	if w.opts.Tokens != nil {
+		if err := w.opts.Tokens.Save(ctx, w.opts.Name, w.token); err != nil {
+			log.Warn().Err(err).Str("watcher", w.opts.Name).Msg("save resume token")
+		}
+	}
+}
+
+// dispatch 所有 handler 都成功后才处理下一个事件
+func (w *watcher) dispatch(ctx context.Context, event *ChangeEvent) error {
+	w.Lock()
+	handlers := w.handlers
+	w.Unlock()
+
+	for _, handler := range handlers {
+		for retry := 0; ; retry++ {
+			err := handler(ctx, event)
+			if err == nil {
+				break
+			}
+
+			log.Warn().Err(err).Str("watcher", w.opts.Name).Str("op", event.OperationType).
+				Int("retry", retry).Msg("handle change event")
+			if !sleep(ctx, backoff(retry)) {
+				return ctx.Err()
+			}
+		}
+	}
+	return nil
+}
+
+func isResumeLost(err error) bool {
+	var cmdErr mongo.CommandError
+	if errors.As(err, &cmdErr) {
+		// ChangeStreamHistoryLost、InvalidResumeToken、ChangeStreamFatalError
+		return cmdErr.Code == 286 || cmdErr.Code == 260 || cmdErr.Code == 280
+	}
+	return false
+}
+
+func backoff(retry int) time.Duration {
+	d := minRetryInterval
+	for i := 0; i < retry && d < maxRetryInterval; i++ {
+		d *= 2
+	}
+	if d > maxRetryInterval {
+		d = maxRetryInterval
+	}
+	return d
+}
+
+func sleep(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// NewCollectionTokenStore resume token 保存在 mongo 的集合中
+func NewCollectionTokenStore(cli Client, table string) ResumeTokenStore {
+	return &collectionTokenStore{cli: cli, table: table}
+}
+
+type collectionTokenStore struct {
+	cli   Client
+	table string
+}
+
+func (s *collectionTokenStore) Load(ctx context.Context, name string) (bson.Raw, error) {
+	doc := struct {
+		Token bson.Raw `bson:"token"`
+	}{}
+	err := s.cli.Collection(s.table).FindOne(ctx, bson.M{"_id": name}).Decode(&doc)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	return doc.Token, err
+}
+
+func (s *collectionTokenStore) Save(ctx context.Context, name string, token bson.Raw) error {
+	_, err := s.cli.Collection(s.table).UpdateOne(ctx, bson.M{"_id": name},
+		bson.M{"$set": bson.M{"token": token, "updatedAt": time.Now()}}, options.Update().SetUpsert(true))
+	return err
+}
@@ -0,0 +1,147 @@
+package mongo
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestBackoff(t *testing.T) {
+	for retry, want := range map[int]time.Duration{
+		0:   100 * time.Millisecond,
+		1:   200 * time.Millisecond,
+		3:   800 * time.Millisecond,
+		9:   maxRetryInterval,
+		100: maxRetryInterval,
+	} {
+		if got := backoff(retry); got != want {
+			t.Fatalf("backoff(%v) = %v, want %v", retry, got, want)
+		}
+	}
+}
+
+func TestIsResumeLost(t *testing.T) {
+	for code, want := range map[int32]bool{286: true, 260: true, 280: true, 11000: false} {
+		err := errors.Wrap(mongo.CommandError{Code: code}, "watch")
+		if got := isResumeLost(err); got != want {
+			t.Fatalf("isResumeLost(%v) = %v, want %v", code, got, want)
+		}
+	}
+
+	if isResumeLost(errors.New("connection reset")) || isResumeLost(nil) {
+		t.Fatal("expect non command error not lost")
+	}
+}
+
+func TestDispatchRetry(t *testing.T) {
+	w := &watcher{opts: &WatchOptions{Name: "test"}}
+
+	var first, second int
+	w.Handle(func(ctx context.Context, event *ChangeEvent) error {
+		first++
+		if first < 2 {
+			return errors.New("busy")
+		}
+		return nil
+	})
+	w.Handle(func(ctx context.Context, event *ChangeEvent) error {
+		second++
+		return nil
+	})
+
+	// 第一个 handler 失败后重试同一个事件，成功后才交给下一个
+	if err := w.dispatch(context.Background(), &ChangeEvent{OperationType: "insert"}); err != nil {
+		t.Fatal(err)
+	}
+	if first != 2 || second != 1 {
+		t.Fatalf("unexpected calls first %v second %v", first, second)
+	}
+}
+
+func TestDispatchCancel(t *testing.T) {
+	w := &watcher{opts: &WatchOptions{Name: "test"}}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	calls := 0
+	w.Handle(func(ctx context.Context, event *ChangeEvent) error {
+		calls++
+		cancel()
+		return errors.New("always fail")
+	})
+
+	if err := w.dispatch(ctx, &ChangeEvent{}); err != context.Canceled {
+		t.Fatalf("expect context canceled, got %v", err)
+	}
+	if calls != 1 {
+		t.Fatalf("expect no retry after cancel, got %v calls", calls)
+	}
+}
+
+// fakeStream 每次 TryNext 都没有事件，只推进 post batch resume token，用完后返回 fail
+type fakeStream struct {
+	tokens []bson.Raw
+	fail   error
+	token  bson.Raw
+	err    error
+}
+
+func (f *fakeStream) TryNext(ctx context.Context) bool {
+	if len(f.tokens) > 0 {
+		f.token, f.tokens = f.tokens[0], f.tokens[1:]
+	} else {
+		f.err = f.fail
+	}
+	return false
+}
+
+func (f *fakeStream) Decode(val interface{}) error    { return nil }
+func (f *fakeStream) ResumeToken() bson.Raw           { return f.token }
+func (f *fakeStream) Err() error                      { return f.err }
+func (f *fakeStream) Close(ctx context.Context) error { return nil }
+
+type memTokens map[string]bson.Raw
+
+func (m memTokens) Load(_ context.Context, name string) (bson.Raw, error) {
+	return m[name], nil
+}
+
+func (m memTokens) Save(_ context.Context, name string, token bson.Raw) error {
+	m[name] = token
+	return nil
+}
+
+func TestReconnectBeforeFirstEvent(t *testing.T) {
+	t1, _ := bson.Marshal(bson.M{"_data": "T1"})
+	t2, _ := bson.Marshal(bson.M{"_data": "T2"})
+	tokens := memTokens{}
+	w := &watcher{opts: &WatchOptions{Name: "test", Tokens: tokens}}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var resumed []bson.Raw
+	w.open = func(ctx context.Context) (changeStream, error) {
+		resumed = append(resumed, w.token)
+		if len(resumed) == 1 {
+			return &fakeStream{tokens: []bson.Raw{t1, t2}, fail: errors.New("connection reset")}, nil
+		}
+		cancel()
+		return nil, ctx.Err()
+	}
+
+	if err := w.Run(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// 没有收到过事件，重连时也从最后一批的 token 继续
+	if len(resumed) != 2 || resumed[0] != nil || string(resumed[1]) != string(t2) {
+		t.Fatalf("unexpected resume tokens %v", resumed)
+	}
+	if string(tokens["test"]) != string(t2) {
+		t.Fatalf("expect token saved, got %v", tokens["test"])
+	}
+}
@@ -0,0 +1,32 @@
+package monitoring
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	configReloadCounter *prometheus.CounterVec
+	configVersionGauge  *prometheus.GaugeVec
+)
+
+func initConfig() {
+	c := createCollector(defaultConf.ServerName, "config", "reload_count", "counter_vec", []string{"key", "status"})
+	configReloadCounter = c.(*prometheus.CounterVec)
+	c = createCollector(defaultConf.ServerName, "config", "applied_version", "gauge_vec", []string{"key"})
+	configVersionGauge = c.(*prometheus.GaugeVec)
+}
+
+// RecordConfigReload 记录配置热更新结果，applied_version 为最后一次生效的版本
+func RecordConfigReload(key string, version uint64, err error) {
+	if configReloadCounter == nil {
+		return
+	}
+
+	status := "OK"
+	if err != nil {
+		status = "ERROR"
+	} else {
+		configVersionGauge.WithLabelValues(key).Set(float64(version))
+	}
+	configReloadCounter.WithLabelValues(key, status).Inc()
+}
@@ -0,0 +1,89 @@
+package monitoring
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	traverseDocsCounter     *prometheus.CounterVec
+	traverseSegmentsCounter *prometheus.CounterVec
+
+	mongoOpsCounter       *prometheus.CounterVec
+	mongoHistogram        *prometheus.HistogramVec
+	mongoCheckoutCounter  *prometheus.CounterVec
+	mongoCheckoutWaitings *prometheus.GaugeVec
+)
+
+func initMongo() {
+	labels := []string{"command", "collection", "instance", "status"}
+	c := createCollector(defaultConf.ServerName, "mongo", "command_count", "counter_vec", labels)
+	mongoOpsCounter = c.(*prometheus.CounterVec)
+	c = createCollector(defaultConf.ServerName, "mongo", "command_duration_seconds", "histogram_vec", labels)
+	mongoHistogram = c.(*prometheus.HistogramVec)
+	c = createCollector(defaultConf.ServerName, "mongo", "pool_checkout_count", "counter_vec", []string{"instance", "status"})
+	mongoCheckoutCounter = c.(*prometheus.CounterVec)
+	c = createCollector(defaultConf.ServerName, "mongo", "pool_checkout_waiting", "gauge_vec", []string{"instance"})
+	mongoCheckoutWaitings = c.(*prometheus.GaugeVec)
+
+	c = createCollector(defaultConf.ServerName, "mongo", "traverse_docs", "counter_vec", []string{"job", "status"})
+	traverseDocsCounter = c.(*prometheus.CounterVec)
+	c = createCollector(defaultConf.ServerName, "mongo", "traverse_segments", "counter_vec", []string{"job", "status"})
+	traverseSegmentsCounter = c.(*prometheus.CounterVec)
+}
+
+func status(err error) string {
+	if err != nil {
+		return "ERROR"
+	}
+	return "OK"
+}
+
+// RecordTraverseDocs 记录遍历处理的文档数
+func RecordTraverseDocs(job string, n int, err error) {
+	if traverseDocsCounter == nil || n == 0 {
+		return
+	}
+	traverseDocsCounter.WithLabelValues(job, status(err)).Add(float64(n))
+}
+
+// RecordTraverseSegment 记录遍历完成的分段
+func RecordTraverseSegment(job string, err error) {
+	if traverseSegmentsCounter == nil {
+		return
+	}
+	traverseSegmentsCounter.WithLabelValues(job, status(err)).Inc()
+}
+
+// GetRecordMongoCallStatsHandler 在命令开始时调用，结束时调用返回的函数
+func GetRecordMongoCallStatsHandler(command, collection, instance string) func(err error) {
+	startTime := time.Now()
+
+	return func(err error) {
+		if mongoOpsCounter == nil {
+			return
+		}
+
+		elapsed := float64(time.Since(startTime).Nanoseconds()) / 1e6
+		mongoHistogram.WithLabelValues(command, collection, instance, status(err)).Observe(elapsed)
+		mongoOpsCounter.WithLabelValues(command, collection, instance, status(err)).Inc()
+	}
+}
+
+// RecordMongoCheckoutStart 开始从连接池获取连接
+func RecordMongoCheckoutStart(instance string) {
+	if mongoCheckoutWaitings == nil {
+		return
+	}
+	mongoCheckoutWaitings.WithLabelValues(instance).Inc()
+}
+
+// RecordMongoCheckoutDone 获取连接结束，status 为 OK、timeout 或其他失败原因
+func RecordMongoCheckoutDone(instance, status string) {
+	if mongoCheckoutWaitings == nil {
+		return
+	}
+	mongoCheckoutWaitings.WithLabelValues(instance).Dec()
+	mongoCheckoutCounter.WithLabelValues(instance, status).Inc()
+}
@@ -1,6 +1,7 @@
 package monitoring
 
 import (
+	"context"
 	"errors"
 	"net/http"
 
@@ -20,6 +21,8 @@ var (
 		Path:       "",
 		ServerName: "",
 	}
+
+	metricServer *http.Server
 )
 
 func Serve(conf *Config) error {
@@ -33,12 +36,25 @@ func Serve(conf *Config) error {
 
 	initMysql()
 	initRedis()
+	initConfig()
+	initPool()
+	initMongo()
 	// 处理监听问题
 	http.Handle(defaultConf.Path, promhttp.Handler())
 
+	metricServer = &http.Server{Addr: defaultConf.Addr}
 	go func() {
-		_ = http.ListenAndServe(defaultConf.Addr, nil)
+		_ = metricServer.ListenAndServe()
 	}()
 
 	return nil
 }
+
+// Shutdown 关闭指标监听
+func Shutdown(ctx context.Context) error {
+	if metricServer == nil {
+		return nil
+	}
+
+	return metricServer.Shutdown(ctx)
+}
@@ -1,35 +1,75 @@
 package monitoring
 
 import (
+	"sync"
 	"time"
 
 	ginprometheus "github.com/hedemonde/go-gin-prometheus"
 	"github.com/prometheus/client_golang/prometheus"
 )
 
+const (
+	// maxStatements 语句标签的上限，超过后归到 other，避免指标数量失控
+	maxStatements  = 500
+	otherStatement = "other"
+)
+
 var (
 	mysqlOpsCounter *prometheus.CounterVec
 	mysqlHistogram  *prometheus.HistogramVec
+
+	statementMu sync.RWMutex
+	statements  = make(map[string]struct{})
 )
 
 func initMysql() {
-	c := createCollector(defaultConf.ServerName, "mysql", "client_calls", "counter_vec", []string{"method", "instance", "status"})
+	c := createCollector(defaultConf.ServerName, "mysql", "client_calls", "counter_vec", []string{"method", "instance", "statement", "status"})
 	mysqlOpsCounter = c.(*prometheus.CounterVec)
-	c = createCollector(defaultConf.ServerName, "mysql", "client_duration_seconds", "histogram_vec", []string{"method", "instance", "status"})
+	c = createCollector(defaultConf.ServerName, "mysql", "client_duration_seconds", "histogram_vec", []string{"method", "instance", "statement", "status"})
 	mysqlHistogram = c.(*prometheus.HistogramVec)
 }
 
-func GetRecordMysqlCallStatsHandler(method, instance string) func(err error) {
+// statementLabel 只保留前 maxStatements 个出现的语句
+func statementLabel(statement string) string {
+	statementMu.RLock()
+	_, ok := statements[statement]
+	statementMu.RUnlock()
+	if ok {
+		return statement
+	}
+
+	statementMu.Lock()
+	defer statementMu.Unlock()
+	if _, ok = statements[statement]; ok {
+		return statement
+	}
+
+	if len(statements) >= maxStatements {
+		return otherStatement
+	}
+
+	statements[statement] = struct{}{}
+	return statement
+}
+
+// GetRecordMysqlCallStatsHandler statement 为归一化后的 SQL 指纹
+func GetRecordMysqlCallStatsHandler(method, instance, statement string) func(err error) {
 	startTime := time.Now()
+	statement = statementLabel(statement)
 
 	return func(err error) {
+		// 未启动监控服务时不记录
+		if mysqlOpsCounter == nil {
+			return
+		}
+
 		elapsed := float64(time.Since(startTime).Nanoseconds()) / 1e6
 		status := "OK"
 		if err != nil {
 			status = "ERROR"
 		}
-		mysqlHistogram.WithLabelValues(method, instance, status).Observe(elapsed)
-		mysqlOpsCounter.WithLabelValues(method, instance, status).Inc()
+		mysqlHistogram.WithLabelValues(method, instance, statement, status).Observe(elapsed)
+		mysqlOpsCounter.WithLabelValues(method, instance, statement, status).Inc()
 	}
 }
 
@@ -0,0 +1,90 @@
+package monitoring
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// PoolStats 连接池状态，累计值从连接池创建开始计算
+type PoolStats struct {
+	MaxConns     uint32        // 连接池上限
+	TotalConns   uint32        // 当前连接数
+	IdleConns    uint32        // 空闲连接数
+	WaitCount    uint64        // 等待空闲连接的次数
+	WaitDuration time.Duration // 等待空闲连接的总时长
+	Timeouts     uint64        // 等待超时的次数
+}
+
+// PoolStatsFunc 返回各个节点的连接池状态，key 为节点地址
+type PoolStatsFunc func() map[string]PoolStats
+
+var pools = &poolCollector{sources: make(map[string]PoolStatsFunc)}
+
+// RegisterPoolStats 注册连接池状态，同一个 kind 重复注册时替换，连接重建后需要重新注册
+func RegisterPoolStats(kind string, fn PoolStatsFunc) {
+	pools.Lock()
+	defer pools.Unlock()
+	pools.sources[kind] = fn
+}
+
+func initPool() {
+	labels := []string{"kind", "instance"}
+	name := func(n string) string {
+		return prometheus.BuildFQName("", defaultConf.ServerName, n)
+	}
+
+	pools.maxConns = prometheus.NewDesc(name("pool_max_connections"), "max connections of the pool", labels, nil)
+	pools.connections = prometheus.NewDesc(name("pool_connections"), "connections of the pool by state",
+		append(labels, "state"), nil)
+	pools.waitCount = prometheus.NewDesc(name("pool_wait_count"), "times waited for a connection", labels, nil)
+	pools.waitSeconds = prometheus.NewDesc(name("pool_wait_seconds"), "total time waited for a connection", labels, nil)
+	pools.timeouts = prometheus.NewDesc(name("pool_timeout_count"), "times timed out waiting for a connection", labels, nil)
+
+	_ = prometheus.Register(pools)
+}
+
+type poolCollector struct {
+	sync.Mutex
+	sources map[string]PoolStatsFunc
+
+	maxConns    *prometheus.Desc
+	connections *prometheus.Desc
+	waitCount   *prometheus.Desc
+	waitSeconds *prometheus.Desc
+	timeouts    *prometheus.Desc
+}
+
+func (p *poolCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- p.maxConns
+	ch <- p.connections
+	ch <- p.waitCount
+	ch <- p.waitSeconds
+	ch <- p.timeouts
+}
+
+func (p *poolCollector) Collect(ch chan<- prometheus.Metric) {
+	p.Lock()
+	sources := make(map[string]PoolStatsFunc, len(p.sources))
+	for kind, fn := range p.sources {
+		sources[kind] = fn
+	}
+	p.Unlock()
+
+	for kind, fn := range sources {
+		for instance, stats := range fn() {
+			inUse := float64(stats.TotalConns) - float64(stats.IdleConns)
+			if inUse < 0 {
+				inUse = 0
+			}
+
+			ch <- prometheus.MustNewConstMetric(p.maxConns, prometheus.GaugeValue, float64(stats.MaxConns), kind, instance)
+			ch <- prometheus.MustNewConstMetric(p.connections, prometheus.GaugeValue, float64(stats.IdleConns), kind, instance, "idle")
+			ch <- prometheus.MustNewConstMetric(p.connections, prometheus.GaugeValue, inUse, kind, instance, "in_use")
+			ch <- prometheus.MustNewConstMetric(p.waitCount, prometheus.CounterValue, float64(stats.WaitCount), kind, instance)
+			ch <- prometheus.MustNewConstMetric(p.waitSeconds, prometheus.CounterValue, stats.WaitDuration.Seconds(), kind, instance)
+			ch <- prometheus.MustNewConstMetric(p.timeouts, prometheus.CounterValue, float64(stats.Timeouts), kind, instance)
+		}
+	}
+}
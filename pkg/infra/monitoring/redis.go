@@ -22,6 +22,11 @@ func GetRecordRedisCallStatsHandler(command, instance string) func(err error) {
 	startTime := time.Now()
 
 	return func(err error) {
+		// 未启动监控服务时不记录
+		if redisOpsCounter == nil {
+			return
+		}
+
 		elapsed := float64(time.Since(startTime).Nanoseconds()) / 1e6
 		status := "OK"
 		if err != nil {
@@ -0,0 +1,51 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"io"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// fakeDriver 每次查询都返回固定的列和行，用于测试扫描逻辑
+type fakeDriver struct {
+	columns []string
+	values  [][]driver.Value
+}
+
+func newFakeDB(columns []string, values ...[]driver.Value) *sqlx.DB {
+	return sqlx.NewDb(sql.OpenDB(&fakeDriver{columns: columns, values: values}), "mysql")
+}
+
+func (d *fakeDriver) Connect(context.Context) (driver.Conn, error) { return d, nil }
+func (d *fakeDriver) Driver() driver.Driver                        { return d }
+func (d *fakeDriver) Open(string) (driver.Conn, error)             { return d, nil }
+func (d *fakeDriver) Prepare(string) (driver.Stmt, error)          { return d, nil }
+func (d *fakeDriver) Close() error                                 { return nil }
+func (d *fakeDriver) Begin() (driver.Tx, error)                    { return nil, io.EOF }
+func (d *fakeDriver) NumInput() int                                { return -1 }
+func (d *fakeDriver) Exec([]driver.Value) (driver.Result, error)   { return driver.RowsAffected(0), nil }
+
+func (d *fakeDriver) Query([]driver.Value) (driver.Rows, error) {
+	return &fakeDriverRows{columns: d.columns, values: d.values}, nil
+}
+
+type fakeDriverRows struct {
+	columns []string
+	values  [][]driver.Value
+	pos     int
+}
+
+func (r *fakeDriverRows) Columns() []string { return r.columns }
+func (r *fakeDriverRows) Close() error      { return nil }
+
+func (r *fakeDriverRows) Next(dest []driver.Value) error {
+	if r.pos >= len(r.values) {
+		return io.EOF
+	}
+	copy(dest, r.values[r.pos])
+	r.pos++
+	return nil
+}
@@ -0,0 +1,219 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+)
+
+// Rows 逐行读取结果，内存中只保留当前行，用完必须 Close
+type Rows interface {
+	// Next 准备下一行，没有更多数据、出错或 ctx 取消时返回 false
+	Next() bool
+	// Scan 多列结果扫描到结构体时按 db tag，其他情况按列顺序扫描
+	Scan(dest interface{}) error
+	Err() error
+	Close() error
+}
+
+// Keyset 按递增的键分页扫描，Query 的最后两个占位符为起始键和条数，例如
+// SELECT id, name FROM player WHERE id > ? ORDER BY id LIMIT ?
+// 每页是一次独立的查询，不会长时间占用连接
+type Keyset struct {
+	Query    string
+	Args     []interface{} // 起始键之前的参数
+	Start    interface{}   // 起始键，不包含
+	PageSize int
+}
+
+// KeyFunc 处理 dest 中的当前行，返回这一行的键作为下一页的起始键
+type KeyFunc func() (key interface{}, err error)
+
+type rows struct {
+	*sqlx.Rows
+	ctx     context.Context
+	once    sync.Once
+	done    func(err error)
+	columns int
+}
+
+func (r *rows) Next() bool {
+	if r.ctx.Err() != nil {
+		return false
+	}
+	return r.Rows.Next()
+}
+
+func (r *rows) Scan(dest interface{}) error {
+	if r.columns == 0 {
+		columns, err := r.Columns()
+		if err != nil {
+			return err
+		}
+		r.columns = len(columns)
+	}
+
+	if structScan(dest, r.columns) {
+		return r.StructScan(dest)
+	}
+	return r.Rows.Scan(dest)
+}
+
+var (
+	scannerType = reflect.TypeOf((*sql.Scanner)(nil)).Elem()
+	timeType    = reflect.TypeOf(time.Time{})
+)
+
+// structScan 与 sqlx 的规则相同：实现了 sql.Scanner 的结构体、time.Time 以及只有一列时按列扫描
+func structScan(dest interface{}, columns int) bool {
+	t := reflect.TypeOf(dest)
+	if t == nil || t.Kind() != reflect.Ptr || t.Elem().Kind() != reflect.Struct {
+		return false
+	}
+
+	if t.Implements(scannerType) || t.Elem() == timeType {
+		return false
+	}
+	return columns > 1
+}
+
+func (r *rows) Err() error {
+	if err := r.Rows.Err(); err != nil {
+		return err
+	}
+	return r.ctx.Err()
+}
+
+// Close 关闭时记录监控，耗时包括读取全部数据的时间
+func (r *rows) Close() error {
+	err := r.Rows.Close()
+	r.once.Do(func() {
+		if e := r.Err(); e != nil {
+			r.done(e)
+			return
+		}
+		r.done(err)
+	})
+	return err
+}
+
+func (s session) queryRows(ctx context.Context, method string, done func(err error), query string, args ...interface{}) (Rows, error) {
+	ctx, statHandler := s.stat(ctx, method, query, args)
+	finish := func(err error) {
+		statHandler(err)
+		if done != nil {
+			done(err)
+		}
+	}
+
+	rs, err := s.e.QueryxContext(ctx, query, args...)
+	if err != nil {
+		finish(err)
+		return nil, err
+	}
+
+	return &rows{Rows: rs, ctx: ctx, done: finish}, nil
+}
+
+func (s session) QueryRows(ctx context.Context, query string, args ...interface{}) (Rows, error) {
+	return s.queryRows(ctx, "QueryRows", nil, query, args...)
+}
+
+// each 每一行扫描到 dest 后调用 fn，返回处理的行数
+func each(rs Rows, dest interface{}, fn func() error) (n int, err error) {
+	defer func() {
+		if e := rs.Close(); err == nil {
+			err = e
+		}
+	}()
+
+	for rs.Next() {
+		if err = rs.Scan(dest); err != nil {
+			return n, err
+		}
+
+		if err = fn(); err != nil {
+			return n, err
+		}
+		n++
+	}
+
+	return n, rs.Err()
+}
+
+func (s session) QueryEach(ctx context.Context, dest interface{}, fn func() error, query string, args ...interface{}) error {
+	rs, err := s.queryRows(ctx, "QueryEach", nil, query, args...)
+	if err != nil {
+		return err
+	}
+
+	_, err = each(rs, dest, fn)
+	return err
+}
+
+// queryKeyset open 每一页打开一次查询
+func queryKeyset(ctx context.Context, ks Keyset, dest interface{}, fn KeyFunc,
+	open func(query string, args ...interface{}) (Rows, error)) error {
+	if ks.PageSize <= 0 {
+		return errors.New("keyset page size must be positive")
+	}
+
+	key := ks.Start
+	for {
+		args := append(append(make([]interface{}, 0, len(ks.Args)+2), ks.Args...), key, ks.PageSize)
+		rs, err := open(ks.Query, args...)
+		if err != nil {
+			return err
+		}
+
+		n, err := each(rs, dest, func() error {
+			next, err := fn()
+			key = next
+			return err
+		})
+		if err != nil {
+			return err
+		}
+
+		if n < ks.PageSize {
+			return nil
+		}
+	}
+}
+
+func (s session) QueryKeyset(ctx context.Context, ks Keyset, dest interface{}, fn KeyFunc) error {
+	return queryKeyset(ctx, ks, dest, fn, func(query string, args ...interface{}) (Rows, error) {
+		return s.queryRows(ctx, "QueryKeyset", nil, query, args...)
+	})
+}
+
+// QueryRows 在从库上查询，读取完毕后 Close 时记录监控
+func (c *client) QueryRows(ctx context.Context, query string, args ...interface{}) (Rows, error) {
+	n, s := c.reader(ctx)
+	return s.queryRows(ctx, "QueryRows", func(err error) { c.lb.done(n, err) }, query, args...)
+}
+
+// QueryEach 在从库上查询，每一行扫描到 dest 后调用 fn，fn 返回错误时停止
+func (c *client) QueryEach(ctx context.Context, dest interface{}, fn func() error, query string, args ...interface{}) error {
+	n, s := c.reader(ctx)
+	rs, err := s.queryRows(ctx, "QueryEach", func(err error) { c.lb.done(n, err) }, query, args...)
+	if err != nil {
+		return err
+	}
+
+	_, err = each(rs, dest, fn)
+	return err
+}
+
+// QueryKeyset 按键分页扫描全表，每一页重新选择从库
+func (c *client) QueryKeyset(ctx context.Context, ks Keyset, dest interface{}, fn KeyFunc) error {
+	return queryKeyset(ctx, ks, dest, fn, func(query string, args ...interface{}) (Rows, error) {
+		n, s := c.reader(ctx)
+		return s.queryRows(ctx, "QueryKeyset", func(err error) { c.lb.done(n, err) }, query, args...)
+	})
+}
@@ -0,0 +1,120 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type fakeRows struct {
+	ids []int
+	pos int
+}
+
+func (f *fakeRows) Next() bool {
+	f.pos++
+	return f.pos <= len(f.ids)
+}
+
+func (f *fakeRows) Scan(dest interface{}) error {
+	*dest.(*int) = f.ids[f.pos-1]
+	return nil
+}
+
+func (f *fakeRows) Err() error   { return nil }
+func (f *fakeRows) Close() error { return nil }
+
+func TestQueryKeyset(t *testing.T) {
+	table := []int{1, 2, 3, 5, 8}
+	pages := 0
+	open := func(query string, args ...interface{}) (Rows, error) {
+		pages++
+		start, limit := args[1].(int), args[2].(int)
+		page := make([]int, 0)
+		for _, id := range table {
+			if id > start && len(page) < limit {
+				page = append(page, id)
+			}
+		}
+		return &fakeRows{ids: page}, nil
+	}
+
+	var id int
+	seen := make([]int, 0)
+	ks := Keyset{Args: []interface{}{"arg"}, Start: 0, PageSize: 2}
+	err := queryKeyset(context.Background(), ks, &id, func() (interface{}, error) {
+		seen = append(seen, id)
+		return id, nil
+	}, open)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(seen) != len(table) || seen[4] != 8 {
+		t.Fatalf("unexpected rows %v", seen)
+	}
+
+	if pages != 3 {
+		t.Fatalf("expect 3 pages, got %v", pages)
+	}
+}
+
+func queryFake(t *testing.T, db *sqlx.DB) Rows {
+	s := session{e: db, instance: "fake"}
+	r, err := s.QueryRows(context.Background(), "SELECT 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = r.Close() })
+
+	if !r.Next() {
+		t.Fatalf("expect a row, err %v", r.Err())
+	}
+	return r
+}
+
+func TestRowsScanSingleColumn(t *testing.T) {
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+
+	var created time.Time
+	if err := queryFake(t, newFakeDB([]string{"created"}, []driver.Value{now})).Scan(&created); err != nil {
+		t.Fatal(err)
+	}
+	if !created.Equal(now) {
+		t.Fatalf("unexpected time %v", created)
+	}
+
+	var name sql.NullString
+	if err := queryFake(t, newFakeDB([]string{"name"}, []driver.Value{"tom"})).Scan(&name); err != nil {
+		t.Fatal(err)
+	}
+	if !name.Valid || name.String != "tom" {
+		t.Fatalf("unexpected name %v", name)
+	}
+
+	var coin sql.NullInt64
+	if err := queryFake(t, newFakeDB([]string{"coin"}, []driver.Value{nil})).Scan(&coin); err != nil {
+		t.Fatal(err)
+	}
+	if coin.Valid {
+		t.Fatalf("expect null coin, got %v", coin)
+	}
+}
+
+func TestRowsScanStruct(t *testing.T) {
+	var player struct {
+		ID   int64  `db:"id"`
+		Name string `db:"name"`
+	}
+	r := queryFake(t, newFakeDB([]string{"id", "name"}, []driver.Value{int64(7), "tom"}))
+	if err := r.Scan(&player); err != nil {
+		t.Fatal(err)
+	}
+	if player.ID != 7 || player.Name != "tom" {
+		t.Fatalf("unexpected player %+v", player)
+	}
+}
@@ -0,0 +1,290 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+)
+
+const (
+	migrationTable = "schema_migrations"
+	// migrationLockTimeout 等待其他节点迁移完成的时长，秒
+	migrationLockTimeout = 60
+)
+
+// migrationFile 文件名格式 0001_create_player.up.sql、0001_create_player.down.sql
+var migrationFile = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// Migration 一个版本的迁移脚本，每条语句以分号结尾
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+// MigrationStatus 迁移状态
+type MigrationStatus struct {
+	Migration
+	Applied   bool
+	AppliedAt time.Time
+}
+
+// Migrator 按版本号执行迁移，通过 GET_LOCK 保证同一个库只有一个节点在迁移
+type Migrator struct {
+	db         *sqlx.DB
+	migrations []Migration
+}
+
+// NewMigrator 从 fsys 的 dir 目录加载迁移脚本，db 通常为 Client.GetOriginalSource()
+func NewMigrator(db *sqlx.DB, fsys fs.FS, dir string) (*Migrator, error) {
+	migrations, err := loadMigrations(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Migrator{db: db, migrations: migrations}, nil
+}
+
+func loadMigrations(fsys fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, errors.Wrapf(err, "read migrations dir %v", dir)
+	}
+
+	byVersion := make(map[int64]*Migration)
+	for _, entry := range entries {
+		match := migrationFile.FindStringSubmatch(entry.Name())
+		if entry.IsDir() || match == nil {
+			continue
+		}
+
+		version, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil {
+			return nil, errors.Wrapf(err, "migration %v", entry.Name())
+		}
+
+		data, err := fs.ReadFile(fsys, path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, errors.Wrapf(err, "read migration %v", entry.Name())
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		} else if m.Name != match[2] {
+			return nil, errors.Errorf("migration version %v has two names: %v, %v", version, m.Name, match[2])
+		}
+
+		if match[3] == "up" {
+			m.Up = string(data)
+		} else {
+			m.Down = string(data)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, errors.Errorf("migration %v_%v has no up script", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
+
+// splitStatements 以行尾的分号分隔语句，忽略空行和 -- 注释
+func splitStatements(script string) []string {
+	statements := make([]string, 0)
+	var current strings.Builder
+	for _, line := range strings.Split(script, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "--") {
+			continue
+		}
+
+		current.WriteString(line)
+		current.WriteString("\n")
+		if strings.HasSuffix(trimmed, ";") {
+			statements = append(statements, strings.TrimSpace(current.String()))
+			current.Reset()
+		}
+	}
+
+	if rest := strings.TrimSpace(current.String()); rest != "" {
+		statements = append(statements, rest)
+	}
+
+	return statements
+}
+
+// withLock 在同一个连接上加锁、执行、解锁，GET_LOCK 属于连接
+func (m *Migrator) withLock(ctx context.Context, fn func(conn *sqlx.Conn) error) error {
+	conn, err := m.db.Connx(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	var locked sql.NullInt64
+	err = conn.GetContext(ctx, &locked, "SELECT GET_LOCK(CONCAT(?, '.', DATABASE()), ?)",
+		migrationTable, migrationLockTimeout)
+	if err != nil {
+		return errors.Wrap(err, "get migration lock")
+	}
+
+	if !locked.Valid || locked.Int64 != 1 {
+		return errors.Errorf("get migration lock timeout after %vs", migrationLockTimeout)
+	}
+
+	defer func() {
+		_, _ = conn.ExecContext(context.Background(), "SELECT RELEASE_LOCK(CONCAT(?, '.', DATABASE()))", migrationTable)
+	}()
+
+	_, err = conn.ExecContext(ctx, fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	version BIGINT NOT NULL PRIMARY KEY,
+	name VARCHAR(255) NOT NULL,
+	applied_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`, migrationTable))
+	if err != nil {
+		return errors.Wrapf(err, "create %v", migrationTable)
+	}
+
+	return fn(conn)
+}
+
+type appliedMigration struct {
+	Version   int64  `db:"version"`
+	Name      string `db:"name"`
+	AppliedAt int64  `db:"applied_at"` // DSN 没有 parseTime 时无法直接解析 DATETIME
+}
+
+func (m *Migrator) applied(ctx context.Context, conn *sqlx.Conn) (map[int64]appliedMigration, error) {
+	rows := make([]appliedMigration, 0)
+	err := conn.SelectContext(ctx, &rows, fmt.Sprintf("SELECT version, name, UNIX_TIMESTAMP(applied_at) AS applied_at FROM %s", migrationTable))
+	if err != nil {
+		return nil, errors.Wrap(err, "query applied migrations")
+	}
+
+	applied := make(map[int64]appliedMigration, len(rows))
+	for _, row := range rows {
+		applied[row.Version] = row
+	}
+	return applied, nil
+}
+
+func (m *Migrator) exec(ctx context.Context, conn *sqlx.Conn, mig Migration, script string) error {
+	for _, statement := range splitStatements(script) {
+		if _, err := conn.ExecContext(ctx, statement); err != nil {
+			return errors.Wrapf(err, "migration %v_%v", mig.Version, mig.Name)
+		}
+	}
+	return nil
+}
+
+// Up 执行所有未执行的迁移，返回本次执行的迁移
+// NOTE: mysql 的 DDL 会隐式提交，迁移中途失败需要人工处理
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	done := make([]Migration, 0)
+	err := m.withLock(ctx, func(conn *sqlx.Conn) error {
+		applied, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for _, mig := range m.migrations {
+			if _, ok := applied[mig.Version]; ok {
+				continue
+			}
+
+			if err = m.exec(ctx, conn, mig, mig.Up); err != nil {
+				return err
+			}
+
+			_, err = conn.ExecContext(ctx, fmt.Sprintf("INSERT INTO %s (version, name) VALUES (?, ?)", migrationTable),
+				mig.Version, mig.Name)
+			if err != nil {
+				return errors.Wrapf(err, "record migration %v_%v", mig.Version, mig.Name)
+			}
+			done = append(done, mig)
+		}
+
+		return nil
+	})
+
+	return done, err
+}
+
+// Down 按版本倒序回滚最近 steps 个已执行的迁移
+func (m *Migrator) Down(ctx context.Context, steps int) ([]Migration, error) {
+	done := make([]Migration, 0)
+	err := m.withLock(ctx, func(conn *sqlx.Conn) error {
+		applied, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for i := len(m.migrations) - 1; i >= 0 && len(done) < steps; i-- {
+			mig := m.migrations[i]
+			if _, ok := applied[mig.Version]; !ok {
+				continue
+			}
+
+			if mig.Down == "" {
+				return errors.Errorf("migration %v_%v has no down script", mig.Version, mig.Name)
+			}
+
+			if err = m.exec(ctx, conn, mig, mig.Down); err != nil {
+				return err
+			}
+
+			_, err = conn.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s WHERE version = ?", migrationTable), mig.Version)
+			if err != nil {
+				return errors.Wrapf(err, "remove migration %v_%v", mig.Version, mig.Name)
+			}
+			done = append(done, mig)
+		}
+
+		return nil
+	})
+
+	return done, err
+}
+
+// Status 所有迁移的执行状态
+func (m *Migrator) Status(ctx context.Context) ([]MigrationStatus, error) {
+	status := make([]MigrationStatus, 0, len(m.migrations))
+	err := m.withLock(ctx, func(conn *sqlx.Conn) error {
+		applied, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for _, mig := range m.migrations {
+			st := MigrationStatus{Migration: mig}
+			if row, ok := applied[mig.Version]; ok {
+				st.Applied, st.AppliedAt = true, time.Unix(row.AppliedAt, 0)
+			}
+			status = append(status, st)
+		}
+		return nil
+	})
+
+	return status, err
+}
@@ -0,0 +1,33 @@
+package mysql
+
+import (
+	"testing"
+	"testing/fstest"
+)
+
+func TestLoadMigrations(t *testing.T) {
+	fsys := fstest.MapFS{
+		"m/0002_add_level.up.sql":       {Data: []byte("ALTER TABLE player ADD level INT;")},
+		"m/0001_create_player.up.sql":   {Data: []byte("-- player\nCREATE TABLE player (\n id INT\n);\nCREATE INDEX idx ON player (id);\n")},
+		"m/0001_create_player.down.sql": {Data: []byte("DROP TABLE player;")},
+		"m/README.md":                   {Data: []byte("ignored")},
+	}
+
+	migrations, err := loadMigrations(fsys, "m")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(migrations) != 2 || migrations[0].Version != 1 || migrations[1].Version != 2 {
+		t.Fatalf("unexpected migrations %+v", migrations)
+	}
+
+	if migrations[0].Down == "" || migrations[1].Down != "" {
+		t.Fatalf("unexpected down scripts %+v", migrations)
+	}
+
+	statements := splitStatements(migrations[0].Up)
+	if len(statements) != 2 || statements[0] != "CREATE TABLE player (\n id INT\n);" {
+		t.Fatalf("unexpected statements %q", statements)
+	}
+}
@@ -17,20 +17,79 @@ var _ Client = (*client)(nil)
 
 // Config mysql配置信息
 type Config struct {
-	Host        string `json:"host"`
-	Port        int    `json:"port"`
-	User        string `json:"user"`
-	Password    string `json:"password"`
-	DBName      string `json:"dbname"`
-	CharSet     string `json:"charset"`
-	MaxConn     int    `json:"maxConn"`
-	IdleConn    int    `json:"idleConn"`
-	IdleTimeout int    `json:"idleTimeout"`
+	Host         string        `json:"host"`
+	Port         int           `json:"port"`
+	User         string        `json:"user"`
+	Password     string        `json:"password"`
+	DBName       string        `json:"dbname"`
+	CharSet      string        `json:"charset"`
+	MaxConn      int           `json:"maxConn"`
+	IdleConn     int           `json:"idleConn"`
+	IdleTimeout  int           `json:"idleTimeout"` // 秒，空闲连接的最长保留时间
+	MaxLifetime  int           `json:"maxLifetime"` // 秒，连接的最长使用时间
+	Timeout      int           `json:"timeout"`     // 毫秒，连接超时，DialTimeout 为 0 时使用
+	DialTimeout  time.Duration `json:"-"`
+	ReadTimeout  time.Duration `json:"-"`
+	WriteTimeout time.Duration `json:"-"`
+
+	// Replicas 从库地址 host:port，账号和库名与主库相同，读请求轮询从库
+	Replicas  []string `json:"replicas"`
+	EjectTime int      `json:"ejectTime"` // 秒，从库连接出错后暂停使用的时长
+
+	SlowThreshold int `json:"slowThreshold"` // 毫秒，超过后打印慢查询日志，0 不打印
 }
 
-func (cf *Config) getSource() string {
-	return fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?charset=%s",
-		cf.User, cf.Password, cf.Host, cf.Port, cf.DBName, cf.CharSet)
+// 与服务主库相同的默认值
+const (
+	defaultCharSet       = "utf8mb4"
+	defaultMaxConn       = 200
+	defaultIdleConn      = 10
+	defaultDialTimeout   = 5 * time.Second
+	defaultSlowThreshold = 500 // ms
+)
+
+// withDefaults 返回填充了默认值的副本，用于直接从配置中心解析的节点配置
+func (cf Config) withDefaults() Config {
+	if cf.CharSet == "" {
+		cf.CharSet = defaultCharSet
+	}
+	if cf.MaxConn <= 0 {
+		cf.MaxConn = defaultMaxConn
+	}
+	if cf.IdleConn <= 0 {
+		cf.IdleConn = defaultIdleConn
+	}
+	if cf.DialTimeout <= 0 {
+		cf.DialTimeout = defaultDialTimeout
+		if cf.Timeout > 0 {
+			cf.DialTimeout = time.Duration(cf.Timeout) * time.Millisecond
+		}
+	}
+	if cf.SlowThreshold <= 0 {
+		cf.SlowThreshold = defaultSlowThreshold
+	}
+	return cf
+}
+
+func (cf *Config) getSource(addr string) string {
+	source := fmt.Sprintf("%s:%s@tcp(%s)/%s?charset=%s",
+		cf.User, cf.Password, addr, cf.DBName, cf.CharSet)
+
+	if cf.DialTimeout > 0 {
+		source += fmt.Sprintf("&timeout=%v", cf.DialTimeout)
+	}
+	if cf.ReadTimeout > 0 {
+		source += fmt.Sprintf("&readTimeout=%v", cf.ReadTimeout)
+	}
+	if cf.WriteTimeout > 0 {
+		source += fmt.Sprintf("&writeTimeout=%v", cf.WriteTimeout)
+	}
+
+	return source
+}
+
+func (cf *Config) instance() string {
+	return fmt.Sprintf("%s:%d", cf.Host, cf.Port)
 }
 
 type Client interface {
@@ -40,6 +99,15 @@ type Client interface {
 	// QueryMulti ...
 	QueryMulti(ctx context.Context, dest interface{}, query string, args ...interface{}) error
 
+	// QueryRows 逐行读取大结果集，内存中只保留当前行
+	QueryRows(ctx context.Context, query string, args ...interface{}) (Rows, error)
+
+	// QueryEach 每一行扫描到 dest 后调用 fn，fn 返回错误时停止
+	QueryEach(ctx context.Context, dest interface{}, fn func() error, query string, args ...interface{}) error
+
+	// QueryKeyset 按键分页扫描，适合遍历大表
+	QueryKeyset(ctx context.Context, ks Keyset, dest interface{}, fn KeyFunc) error
+
 	// Insert 使用占位符 ? 传参  insert into tb (name, id) values (?, ?)
 	Insert(ctx context.Context, query string, args ...interface{}) (int64, error)
 
@@ -59,141 +127,163 @@ type Client interface {
 	// IsNoRowsError ...
 	IsNoRowsError(err error) bool
 
-	// GetOriginalSource 获取内部的db源
+	// GetOriginalSource 获取内部的db源，读写分离时为主库
 	GetOriginalSource() interface{}
 
 	// ReplaceIntoMulti ...
 	ReplaceIntoMulti(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+
+	// WithTx 在主库上执行事务，fn 返回 nil 时提交，返回错误或 panic 时回滚
+	WithTx(ctx context.Context, opts *sql.TxOptions, fn TxFunc) error
+
+	// PoolStats 连接池状态
+	PoolStats() map[string]monitoring.PoolStats
+
+	// Close 关闭连接池
+	Close() error
 }
 
-// NewMysqlPoolWithTrace 构建带trace的sqlpool
+// NewMysqlPoolWithTrace 构建带trace的sqlpool，主库不可用时返回错误，从库不可用时先摘除
 func NewMysqlPoolWithTrace(cfg *Config) (Client, error) {
-	db, err := sql.Open("mysql", cfg.getSource())
+	primary, err := openNode(cfg, cfg.instance())
 	if err != nil {
 		return nil, err
 	}
 
-	// Wrap our *sql.DB with sqlx. use the original db driver name!!!
-	pool := sqlx.NewDb(db, "mysql")
-	err = pool.Ping()
+	if err = primary.db.Ping(); err != nil {
+		_ = primary.db.Close()
+		return nil, err
+	}
+
+	ejectTime := defaultEjectTime
+	if cfg.EjectTime > 0 {
+		ejectTime = time.Duration(cfg.EjectTime) * time.Second
+	}
+
+	lb := &balancer{primary: primary, ejectTime: ejectTime}
+	for _, addr := range cfg.Replicas {
+		replica, err := openNode(cfg, addr)
+		if err != nil {
+			for _, n := range lb.nodes() {
+				_ = n.db.Close()
+			}
+			return nil, errors.Wrapf(err, "replica %v", addr)
+		}
+
+		if err = replica.db.Ping(); err != nil {
+			replica.eject(ejectTime)
+		}
+		lb.replicas = append(lb.replicas, replica)
+	}
+
+	return &client{lb: lb}, nil
+}
+
+func openNode(cfg *Config, addr string) (*node, error) {
+	db, err := sql.Open("mysql", cfg.getSource(addr))
 	if err != nil {
 		return nil, err
 	}
 
-	pool.SetConnMaxLifetime(time.Hour * 4)
+	// Wrap our *sql.DB with sqlx. use the original db driver name!!!
+	pool := sqlx.NewDb(db, "mysql")
+
+	maxLifetime := time.Hour * 4
+	if cfg.MaxLifetime > 0 {
+		maxLifetime = time.Duration(cfg.MaxLifetime) * time.Second
+	}
+	pool.SetConnMaxLifetime(maxLifetime)
 	pool.SetMaxOpenConns(cfg.MaxConn)
 	pool.SetMaxIdleConns(cfg.IdleConn)
+	if cfg.IdleTimeout > 0 {
+		pool.SetConnMaxIdleTime(time.Duration(cfg.IdleTimeout) * time.Second)
+	}
 
-	return &client{db: pool}, nil
+	return &node{db: pool, instance: addr, slow: time.Duration(cfg.SlowThreshold) * time.Millisecond}, nil
 }
 
+// client 写请求走主库，读请求走从库，通过 WithPrimary 强制读主库
 type client struct {
-	db *sqlx.DB
+	lb *balancer
 }
 
-func (c *client) QuerySingle(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
-	statHandler := monitoring.GetRecordMysqlCallStatsHandler("QuerySingle", "")
-	err := c.db.GetContext(ctx, dest, query, args)
-	statHandler(err)
+func (c *client) reader(ctx context.Context) (*node, session) {
+	n := c.lb.reader(ctx)
+	return n, session{e: n.db, instance: n.instance, slow: n.slow}
+}
+
+func (c *client) writer() session {
+	n := c.lb.writer()
+	return session{e: n.db, instance: n.instance, slow: n.slow}
+}
 
+func (c *client) QuerySingle(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	n, s := c.reader(ctx)
+	err := s.QuerySingle(ctx, dest, query, args...)
+	c.lb.done(n, err)
 	return err
 }
 
 func (c *client) QueryMulti(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
-	statHandler := monitoring.GetRecordMysqlCallStatsHandler("QueryMulti", "")
-	err := c.db.SelectContext(ctx, dest, query, args...)
-	statHandler(err)
+	n, s := c.reader(ctx)
+	err := s.QueryMulti(ctx, dest, query, args...)
+	c.lb.done(n, err)
 	return err
 }
 
 func (c *client) Insert(ctx context.Context, query string, args ...interface{}) (int64, error) {
-	statHandler := monitoring.GetRecordMysqlCallStatsHandler("Insert", "")
-	result, err := c.db.ExecContext(ctx, query, args...)
-	statHandler(err)
-
-	if err != nil {
-		return 0, err
-	}
-	lastInsertId, err := result.LastInsertId()
-	if err != nil {
-		return 0, err
-	}
-	return lastInsertId, nil
+	return c.writer().Insert(ctx, query, args...)
 }
 
 func (c *client) InsertNamed(ctx context.Context, query string, arg interface{}) (int64, error) {
-	statHandler := monitoring.GetRecordMysqlCallStatsHandler("InsertNamed", "")
-	result, err := c.db.NamedExecContext(ctx, query, arg)
-	statHandler(err)
-
-	if err != nil {
-		return 0, err
-	}
-	lastInsertId, err := result.LastInsertId()
-	if err != nil {
-		return 0, err
-	}
-	return lastInsertId, nil
+	return c.writer().InsertNamed(ctx, query, arg)
 }
 
 func (c *client) Update(ctx context.Context, query string, args ...interface{}) (int64, error) {
-	statHandler := monitoring.GetRecordMysqlCallStatsHandler("Update", "")
-	result, err := c.db.ExecContext(ctx, query, args...)
-	statHandler(err)
-
-	if err != nil {
-		return 0, err
-	}
-	rowAffects, err := result.RowsAffected()
-	if err != nil {
-		return 0, err
-	}
-	return rowAffects, nil
+	return c.writer().Update(ctx, query, args...)
 }
 
 func (c *client) UpdateNamed(ctx context.Context, query string, arg interface{}) (int64, error) {
-	statHandler := monitoring.GetRecordMysqlCallStatsHandler("UpdateNamed", "")
-	result, err := c.db.NamedExecContext(ctx, query, arg)
-	statHandler(err)
-
-	if err != nil {
-		return 0, err
-	}
-	rowAffects, err := result.RowsAffected()
-	if err != nil {
-		return 0, err
-	}
-	return rowAffects, nil
+	return c.writer().UpdateNamed(ctx, query, arg)
 }
 
 func (c *client) Exec(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
-	statHandler := monitoring.GetRecordMysqlCallStatsHandler("Exec", "")
-	result, err := c.db.ExecContext(ctx, query, args...)
-	statHandler(err)
-	return result, err
+	return c.writer().Exec(ctx, query, args...)
 }
 
 func (c *client) IsNoRowsError(err error) bool {
-	return errors.Cause(err) == sql.ErrNoRows
+	return IsNoRowsError(err)
 }
 
 func (c *client) GetOriginalSource() interface{} {
-	return c.db
+	return c.lb.writer().db
 }
 
 func (c *client) ReplaceIntoMulti(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
-	multiQuery, multiArgs, err := sqlx.In(query, args...)
-	if err != nil {
-		return nil, err
-	}
-
-	statHandler := monitoring.GetRecordMysqlCallStatsHandler("ReplaceIntoMulti", "")
-	result, err := c.db.ExecContext(ctx, multiQuery, multiArgs...)
-	statHandler(err)
+	return c.writer().ReplaceIntoMulti(ctx, query, args...)
+}
 
-	if err != nil {
-		return nil, err
+func (c *client) PoolStats() map[string]monitoring.PoolStats {
+	result := make(map[string]monitoring.PoolStats)
+	for _, n := range c.lb.nodes() {
+		stats := n.db.Stats()
+		result[n.instance] = monitoring.PoolStats{
+			MaxConns:     uint32(stats.MaxOpenConnections),
+			TotalConns:   uint32(stats.OpenConnections),
+			IdleConns:    uint32(stats.Idle),
+			WaitCount:    uint64(stats.WaitCount),
+			WaitDuration: stats.WaitDuration,
+		}
 	}
+	return result
+}
 
-	return result, nil
+func (c *client) Close() error {
+	var err error
+	for _, n := range c.lb.nodes() {
+		if e := n.db.Close(); e != nil {
+			err = e
+		}
+	}
+	return err
 }
@@ -0,0 +1,98 @@
+package mysql
+
+import (
+	"context"
+	"database/sql/driver"
+	"net"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+)
+
+const defaultEjectTime = 10 * time.Second
+
+type primaryKey struct{}
+
+// WithPrimary 读请求也走主库，用于写入后需要立即读到最新数据的场景
+func WithPrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, primaryKey{}, true)
+}
+
+func usePrimary(ctx context.Context) bool {
+	v, _ := ctx.Value(primaryKey{}).(bool)
+	return v
+}
+
+// node 一个数据库节点
+type node struct {
+	db       *sqlx.DB
+	instance string
+	slow     time.Duration
+	// ejectedUntil 连接出错后在这个时间点之前不再选择该节点，unix 纳秒
+	ejectedUntil int64
+}
+
+func (n *node) available(now time.Time) bool {
+	return atomic.LoadInt64(&n.ejectedUntil) <= now.UnixNano()
+}
+
+func (n *node) eject(d time.Duration) {
+	atomic.StoreInt64(&n.ejectedUntil, time.Now().Add(d).UnixNano())
+}
+
+// balancer 从库轮询，出错的从库暂时摘除，没有可用从库时使用主库
+type balancer struct {
+	primary   *node
+	replicas  []*node
+	next      uint32
+	ejectTime time.Duration
+}
+
+func (b *balancer) reader(ctx context.Context) *node {
+	if len(b.replicas) == 0 || usePrimary(ctx) {
+		return b.primary
+	}
+
+	now := time.Now()
+	start := atomic.AddUint32(&b.next, 1)
+	for i := 0; i < len(b.replicas); i++ {
+		n := b.replicas[(int(start)+i)%len(b.replicas)]
+		if n.available(now) {
+			return n
+		}
+	}
+
+	return b.primary
+}
+
+func (b *balancer) writer() *node {
+	return b.primary
+}
+
+// done 从库连接出错时摘除
+func (b *balancer) done(n *node, err error) {
+	if n != b.primary && isConnError(err) {
+		n.eject(b.ejectTime)
+	}
+}
+
+func (b *balancer) nodes() []*node {
+	return append([]*node{b.primary}, b.replicas...)
+}
+
+func isConnError(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	cause := errors.Cause(err)
+	if cause == driver.ErrBadConn || cause == mysql.ErrInvalidConn {
+		return true
+	}
+
+	_, ok := cause.(net.Error)
+	return ok
+}
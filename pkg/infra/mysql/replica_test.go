@@ -0,0 +1,39 @@
+package mysql
+
+import (
+	"context"
+	"database/sql/driver"
+	"testing"
+	"time"
+)
+
+func TestBalancer(t *testing.T) {
+	primary := &node{instance: "primary"}
+	r1, r2 := &node{instance: "r1"}, &node{instance: "r2"}
+	lb := &balancer{primary: primary, replicas: []*node{r1, r2}, ejectTime: time.Minute}
+
+	ctx := context.Background()
+	seen := map[string]int{}
+	for i := 0; i < 4; i++ {
+		seen[lb.reader(ctx).instance]++
+	}
+	if seen["r1"] != 2 || seen["r2"] != 2 {
+		t.Fatalf("expect round robin on replicas, got %v", seen)
+	}
+
+	if n := lb.reader(WithPrimary(ctx)); n != primary {
+		t.Fatalf("expect primary with WithPrimary, got %v", n.instance)
+	}
+
+	lb.done(r1, driver.ErrBadConn)
+	for i := 0; i < 4; i++ {
+		if n := lb.reader(ctx); n != r2 {
+			t.Fatalf("expect r1 ejected, got %v", n.instance)
+		}
+	}
+
+	lb.done(r2, driver.ErrBadConn)
+	if n := lb.reader(ctx); n != primary {
+		t.Fatalf("expect fallback to primary, got %v", n.instance)
+	}
+}
@@ -0,0 +1,106 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// executor *sqlx.DB 和 *sqlx.Tx 共有的方法
+type executor interface {
+	GetContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error
+	SelectContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	NamedExecContext(ctx context.Context, query string, arg interface{}) (sql.Result, error)
+	QueryxContext(ctx context.Context, query string, args ...interface{}) (*sqlx.Rows, error)
+}
+
+// session 在连接池或事务上执行语句并记录监控
+type session struct {
+	e        executor
+	instance string
+	slow     time.Duration // 慢查询阈值，0 不记录
+}
+
+func (s session) QuerySingle(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	ctx, statHandler := s.stat(ctx, "QuerySingle", query, args)
+	err := s.e.GetContext(ctx, dest, query, args...)
+	statHandler(err)
+	return err
+}
+
+func (s session) QueryMulti(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	ctx, statHandler := s.stat(ctx, "QueryMulti", query, args)
+	err := s.e.SelectContext(ctx, dest, query, args...)
+	statHandler(err)
+	return err
+}
+
+func (s session) Insert(ctx context.Context, query string, args ...interface{}) (int64, error) {
+	ctx, statHandler := s.stat(ctx, "Insert", query, args)
+	result, err := s.e.ExecContext(ctx, query, args...)
+	statHandler(err)
+
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+func (s session) InsertNamed(ctx context.Context, query string, arg interface{}) (int64, error) {
+	ctx, statHandler := s.stat(ctx, "InsertNamed", query, []interface{}{arg})
+	result, err := s.e.NamedExecContext(ctx, query, arg)
+	statHandler(err)
+
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+func (s session) Update(ctx context.Context, query string, args ...interface{}) (int64, error) {
+	ctx, statHandler := s.stat(ctx, "Update", query, args)
+	result, err := s.e.ExecContext(ctx, query, args...)
+	statHandler(err)
+
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+func (s session) UpdateNamed(ctx context.Context, query string, arg interface{}) (int64, error) {
+	ctx, statHandler := s.stat(ctx, "UpdateNamed", query, []interface{}{arg})
+	result, err := s.e.NamedExecContext(ctx, query, arg)
+	statHandler(err)
+
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+func (s session) Exec(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	ctx, statHandler := s.stat(ctx, "Exec", query, args)
+	result, err := s.e.ExecContext(ctx, query, args...)
+	statHandler(err)
+	return result, err
+}
+
+func (s session) ReplaceIntoMulti(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	multiQuery, multiArgs, err := sqlx.In(query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, statHandler := s.stat(ctx, "ReplaceIntoMulti", multiQuery, multiArgs)
+	result, err := s.e.ExecContext(ctx, multiQuery, multiArgs...)
+	statHandler(err)
+
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
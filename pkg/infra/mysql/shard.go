@@ -0,0 +1,414 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"template/pkg/infra/monitoring"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sync/errgroup"
+)
+
+const (
+	ShardMod   = "mod"   // 按键取模
+	ShardRange = "range" // 按键的范围
+	ShardHash  = "hash"  // 一致性哈希
+
+	hashReplicas = 160
+)
+
+var _ ShardClient = (*shardRouter)(nil)
+
+// ShardConfig 分库分表配置，分片 i 位于 Nodes[i/TablesPerDB]，物理表名为 逻辑表名_i
+type ShardConfig struct {
+	Nodes  []Config             `json:"nodes"`
+	Tables map[string]TableRule `json:"tables"`
+}
+
+// TableRule 逻辑表的分片规则
+type TableRule struct {
+	Strategy    string  `json:"strategy"`
+	TablesPerDB int     `json:"tablesPerDB"` // 每个库的分表数，默认 1
+	Ranges      []int64 `json:"ranges"`      // range 策略每个分片的上界，不包含，个数等于分片数
+}
+
+// ShardClient 按分片键路由到对应的库和表，SQL 中的逻辑表名写作 {player}
+// 分片键优先取 WithShardKey 设置的值，其次取第一个参数
+type ShardClient interface {
+	QuerySingle(ctx context.Context, table string, dest interface{}, query string, args ...interface{}) error
+	QueryMulti(ctx context.Context, table string, dest interface{}, query string, args ...interface{}) error
+	Insert(ctx context.Context, table string, query string, args ...interface{}) (int64, error)
+	Update(ctx context.Context, table string, query string, args ...interface{}) (int64, error)
+	Exec(ctx context.Context, table string, query string, args ...interface{}) (sql.Result, error)
+
+	// Shard 返回分片键所在的库和物理表名，用于事务等需要直接操作的场景
+	Shard(table string, key interface{}) (Client, string, error)
+
+	// Scatter 在所有分片上并发执行 fn，用于管理类查询
+	Scatter(ctx context.Context, table string, fn func(ctx context.Context, cli Client, physical string) error) error
+
+	// ScatterMulti 在所有分片上执行查询，结果合并到 dest 切片中，顺序不保证
+	ScatterMulti(ctx context.Context, table string, dest interface{}, query string, args ...interface{}) error
+
+	// Reload 替换分片配置，配置相同的库复用连接，返回不再使用的连接，由调用方关闭
+	Reload(conf *ShardConfig) ([]Client, error)
+
+	// PoolStats 所有库的连接池状态
+	PoolStats() map[string]monitoring.PoolStats
+
+	Close() error
+}
+
+type shardKey struct{}
+
+// WithShardKey 指定分片键
+func WithShardKey(ctx context.Context, key interface{}) context.Context {
+	return context.WithValue(ctx, shardKey{}, key)
+}
+
+// NewShardClient 配置为空时也可以创建，之后通过 Reload 更新
+func NewShardClient(conf *ShardConfig) (ShardClient, error) {
+	r := &shardRouter{}
+	if _, err := r.Reload(conf); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+type shardRouter struct {
+	sync.Mutex // 串行化 Reload
+	state      atomic.Value
+}
+
+// shardState 一份配置对应的路由，整体替换
+type shardState struct {
+	nodes   []Client
+	configs []string // 用于复用连接
+	tables  map[string]*tableRouter
+}
+
+type tableRouter struct {
+	name        string
+	rule        TableRule
+	shards      int
+	tablesPerDB int
+	ring        []ringNode
+}
+
+type ringNode struct {
+	hash  uint32
+	shard int
+}
+
+func newTableRouter(name string, rule TableRule, dbs int) (*tableRouter, error) {
+	t := &tableRouter{name: name, rule: rule, tablesPerDB: rule.TablesPerDB}
+	if t.tablesPerDB <= 0 {
+		t.tablesPerDB = 1
+	}
+	t.shards = dbs * t.tablesPerDB
+	if t.shards == 0 {
+		return nil, errors.Errorf("table %v has no shard", name)
+	}
+
+	switch rule.Strategy {
+	case ShardMod:
+	case ShardRange:
+		if len(rule.Ranges) != t.shards {
+			return nil, errors.Errorf("table %v needs %v ranges, got %v", name, t.shards, len(rule.Ranges))
+		}
+		for i := 1; i < len(rule.Ranges); i++ {
+			if rule.Ranges[i] <= rule.Ranges[i-1] {
+				return nil, errors.Errorf("table %v ranges must be increasing", name)
+			}
+		}
+	case ShardHash:
+		for shard := 0; shard < t.shards; shard++ {
+			for i := 0; i < hashReplicas; i++ {
+				hash := crc32.ChecksumIEEE([]byte(fmt.Sprintf("%s_%d#%d", name, shard, i)))
+				t.ring = append(t.ring, ringNode{hash: hash, shard: shard})
+			}
+		}
+		sort.Slice(t.ring, func(i, j int) bool {
+			return t.ring[i].hash < t.ring[j].hash
+		})
+	default:
+		return nil, errors.Errorf("table %v unknown strategy '%v'", name, rule.Strategy)
+	}
+
+	return t, nil
+}
+
+// shard 分片编号
+func (t *tableRouter) shard(key interface{}) (int, error) {
+	switch t.rule.Strategy {
+	case ShardMod:
+		n, err := keyNumber(key)
+		if err != nil {
+			n = uint64(crc32.ChecksumIEEE([]byte(fmt.Sprint(key))))
+		}
+		return int(n % uint64(t.shards)), nil
+	case ShardRange:
+		n, err := keyNumber(key)
+		if err != nil {
+			return 0, err
+		}
+		if n > math.MaxInt64 {
+			return 0, errors.Errorf("key %v out of range of table %v", key, t.name)
+		}
+		for i, upper := range t.rule.Ranges {
+			if int64(n) < upper {
+				return i, nil
+			}
+		}
+		return 0, errors.Errorf("key %v out of range of table %v", key, t.name)
+	default:
+		hash := crc32.ChecksumIEEE([]byte(fmt.Sprint(key)))
+		i := sort.Search(len(t.ring), func(i int) bool {
+			return t.ring[i].hash >= hash
+		})
+		if i == len(t.ring) {
+			i = 0
+		}
+		return t.ring[i].shard, nil
+	}
+}
+
+func (t *tableRouter) physical(shard int) string {
+	return fmt.Sprintf("%s_%d", t.name, shard)
+}
+
+func keyNumber(key interface{}) (uint64, error) {
+	v := reflect.ValueOf(key)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if v.Int() < 0 {
+			return 0, errors.Errorf("negative shard key %v", key)
+		}
+		return uint64(v.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return v.Uint(), nil
+	case reflect.String:
+		return strconv.ParseUint(v.String(), 10, 64)
+	default:
+		return 0, errors.Errorf("shard key %v is not a number", key)
+	}
+}
+
+func rewrite(query, table, physical string) string {
+	return strings.ReplaceAll(query, "{"+table+"}", physical)
+}
+
+func (r *shardRouter) current() *shardState {
+	return r.state.Load().(*shardState)
+}
+
+// newPool 测试时替换，避免连接数据库
+var newPool = NewMysqlPoolWithTrace
+
+// Reload 节点配置按主库的默认值补全后比较，没有变化的节点复用连接
+func (r *shardRouter) Reload(conf *ShardConfig) ([]Client, error) {
+	r.Lock()
+	defer r.Unlock()
+
+	var old *shardState
+	if v := r.state.Load(); v != nil {
+		old = v.(*shardState)
+	}
+
+	next := &shardState{tables: make(map[string]*tableRouter, len(conf.Tables))}
+	for name, rule := range conf.Tables {
+		t, err := newTableRouter(name, rule, len(conf.Nodes))
+		if err != nil {
+			return nil, err
+		}
+		next.tables[name] = t
+	}
+
+	reused := make(map[int]bool)
+	created := make([]Client, 0)
+	for i := range conf.Nodes {
+		node := conf.Nodes[i].withDefaults()
+		data, err := json.Marshal(&node)
+		if err != nil {
+			return nil, err
+		}
+
+		var cli Client
+		if old != nil {
+			for j, c := range old.configs {
+				if c == string(data) && !reused[j] {
+					cli, reused[j] = old.nodes[j], true
+					break
+				}
+			}
+		}
+
+		if cli == nil {
+			if cli, err = newPool(&node); err != nil {
+				for _, c := range created {
+					_ = c.Close()
+				}
+				return nil, errors.Wrapf(err, "shard node %v", node.instance())
+			}
+			created = append(created, cli)
+		}
+
+		next.nodes = append(next.nodes, cli)
+		next.configs = append(next.configs, string(data))
+	}
+
+	r.state.Store(next)
+
+	stale := make([]Client, 0)
+	if old != nil {
+		for j, cli := range old.nodes {
+			if !reused[j] {
+				stale = append(stale, cli)
+			}
+		}
+	}
+	return stale, nil
+}
+
+func (r *shardRouter) Shard(table string, key interface{}) (Client, string, error) {
+	state := r.current()
+	t, ok := state.tables[table]
+	if !ok {
+		return nil, "", errors.Errorf("table %v is not sharded", table)
+	}
+
+	shard, err := t.shard(key)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return state.nodes[shard/t.tablesPerDB], t.physical(shard), nil
+}
+
+// route 返回分片的库和改写后的 SQL
+func (r *shardRouter) route(ctx context.Context, table, query string, args []interface{}) (Client, string, error) {
+	key := ctx.Value(shardKey{})
+	if key == nil {
+		if len(args) == 0 {
+			return nil, "", errors.Errorf("no shard key for table %v", table)
+		}
+		key = args[0]
+	}
+
+	cli, physical, err := r.Shard(table, key)
+	if err != nil {
+		return nil, "", err
+	}
+	return cli, rewrite(query, table, physical), nil
+}
+
+func (r *shardRouter) QuerySingle(ctx context.Context, table string, dest interface{}, query string, args ...interface{}) error {
+	cli, query, err := r.route(ctx, table, query, args)
+	if err != nil {
+		return err
+	}
+	return cli.QuerySingle(ctx, dest, query, args...)
+}
+
+func (r *shardRouter) QueryMulti(ctx context.Context, table string, dest interface{}, query string, args ...interface{}) error {
+	cli, query, err := r.route(ctx, table, query, args)
+	if err != nil {
+		return err
+	}
+	return cli.QueryMulti(ctx, dest, query, args...)
+}
+
+func (r *shardRouter) Insert(ctx context.Context, table string, query string, args ...interface{}) (int64, error) {
+	cli, query, err := r.route(ctx, table, query, args)
+	if err != nil {
+		return 0, err
+	}
+	return cli.Insert(ctx, query, args...)
+}
+
+func (r *shardRouter) Update(ctx context.Context, table string, query string, args ...interface{}) (int64, error) {
+	cli, query, err := r.route(ctx, table, query, args)
+	if err != nil {
+		return 0, err
+	}
+	return cli.Update(ctx, query, args...)
+}
+
+func (r *shardRouter) Exec(ctx context.Context, table string, query string, args ...interface{}) (sql.Result, error) {
+	cli, query, err := r.route(ctx, table, query, args)
+	if err != nil {
+		return nil, err
+	}
+	return cli.Exec(ctx, query, args...)
+}
+
+func (r *shardRouter) Scatter(ctx context.Context, table string, fn func(ctx context.Context, cli Client, physical string) error) error {
+	state := r.current()
+	t, ok := state.tables[table]
+	if !ok {
+		return errors.Errorf("table %v is not sharded", table)
+	}
+
+	g, ctx := errgroup.WithContext(ctx)
+	for shard := 0; shard < t.shards; shard++ {
+		cli, physical := state.nodes[shard/t.tablesPerDB], t.physical(shard)
+		g.Go(func() error {
+			return errors.Wrap(fn(ctx, cli, physical), physical)
+		})
+	}
+	return g.Wait()
+}
+
+func (r *shardRouter) ScatterMulti(ctx context.Context, table string, dest interface{}, query string, args ...interface{}) error {
+	slice := reflect.ValueOf(dest)
+	if slice.Kind() != reflect.Ptr || slice.Elem().Kind() != reflect.Slice {
+		return errors.New("dest must be a pointer to slice")
+	}
+
+	var mu sync.Mutex
+	return r.Scatter(ctx, table, func(ctx context.Context, cli Client, physical string) error {
+		part := reflect.New(slice.Elem().Type())
+		if err := cli.QueryMulti(ctx, part.Interface(), rewrite(query, table, physical), args...); err != nil {
+			return err
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		slice.Elem().Set(reflect.AppendSlice(slice.Elem(), part.Elem()))
+		return nil
+	})
+}
+
+func (r *shardRouter) PoolStats() map[string]monitoring.PoolStats {
+	result := make(map[string]monitoring.PoolStats)
+	for _, cli := range r.current().nodes {
+		for instance, stats := range cli.PoolStats() {
+			result[instance] = stats
+		}
+	}
+	return result
+}
+
+func (r *shardRouter) Close() error {
+	r.Lock()
+	defer r.Unlock()
+
+	var err error
+	for _, cli := range r.current().nodes {
+		if e := cli.Close(); e != nil {
+			err = e
+		}
+	}
+	return err
+}
@@ -0,0 +1,108 @@
+package mysql
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestTableRouter(t *testing.T) {
+	mod, err := newTableRouter("player", TableRule{Strategy: ShardMod, TablesPerDB: 2}, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if shard, _ := mod.shard(uint64(7)); shard != 3 || mod.physical(shard) != "player_3" || shard/mod.tablesPerDB != 1 {
+		t.Fatalf("unexpected mod shard %v", shard)
+	}
+
+	ranges, err := newTableRouter("player", TableRule{Strategy: ShardRange, Ranges: []int64{100, 200}}, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if shard, _ := ranges.shard(150); shard != 1 {
+		t.Fatalf("unexpected range shard %v", shard)
+	}
+
+	if _, err = ranges.shard(200); err == nil {
+		t.Fatal("expect out of range error")
+	}
+
+	hash, err := newTableRouter("player", TableRule{Strategy: ShardHash}, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	count := make(map[int]int)
+	for i := 0; i < 4000; i++ {
+		shard, _ := hash.shard(i)
+		count[shard]++
+	}
+	for shard := 0; shard < 4; shard++ {
+		if count[shard] < 500 {
+			t.Fatalf("unbalanced hash shards %v", count)
+		}
+	}
+
+	if q := rewrite("SELECT * FROM {player} WHERE id = ?", "player", "player_3"); q != "SELECT * FROM player_3 WHERE id = ?" {
+		t.Fatalf("unexpected rewrite %v", q)
+	}
+}
+
+func TestShardRangeKeyOverflow(t *testing.T) {
+	ranges, err := newTableRouter("player", TableRule{Strategy: ShardRange, Ranges: []int64{100, math.MaxInt64}}, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = ranges.shard(uint64(math.MaxInt64) + 1); err == nil {
+		t.Fatal("expect out of range error for key above MaxInt64")
+	}
+}
+
+func TestShardReloadDefaults(t *testing.T) {
+	var got []Config
+	newPool = func(cfg *Config) (Client, error) {
+		got = append(got, *cfg)
+		return &client{lb: &balancer{primary: &node{instance: cfg.instance()}}}, nil
+	}
+	defer func() { newPool = NewMysqlPoolWithTrace }()
+
+	// 没有 charset、连接数、超时的节点配置
+	conf := &ShardConfig{Nodes: []Config{{Host: "127.0.0.1", Port: 3306, User: "root", DBName: "db_player"}}}
+	cli, err := NewShardClient(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(got) != 1 {
+		t.Fatalf("expect 1 pool, got %v", len(got))
+	}
+
+	cfg := got[0]
+	source := cfg.getSource(cfg.instance())
+	if !strings.Contains(source, "charset=utf8mb4") || !strings.Contains(source, "timeout=5s") {
+		t.Fatalf("unexpected source %v", source)
+	}
+	if cfg.MaxConn != 200 || cfg.IdleConn != 10 || cfg.SlowThreshold != 500 {
+		t.Fatalf("unexpected pool config %+v", cfg)
+	}
+
+	// 补全默认值后配置相同，复用连接
+	stale, err := cli.Reload(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stale) != 0 || len(got) != 1 {
+		t.Fatalf("expect node reused, stale %v created %v", len(stale), len(got))
+	}
+
+	conf.Nodes[0].Timeout = 1500
+	if _, err = cli.Reload(conf); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || !strings.Contains(got[1].getSource("127.0.0.1:3306"), "timeout=1.5s") {
+		t.Fatalf("expect dial timeout from config, got %+v", got)
+	}
+}
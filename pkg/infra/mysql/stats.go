@@ -0,0 +1,171 @@
+package mysql
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"regexp"
+	"runtime"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"template/pkg/infra/monitoring"
+
+	"github.com/rs/zerolog/log"
+	"go.opencensus.io/trace"
+)
+
+const maxFingerprintLen = 256
+
+var (
+	pkgPath = reflect.TypeOf(session{}).PkgPath()
+
+	inList     = regexp.MustCompile(`\(\s*\?(\s*,\s*\?)*\s*\)`)
+	valuesList = regexp.MustCompile(`\(\?\+\)(\s*,\s*\(\?\+\))+`)
+	// shardTable 分表的物理表名 player_3 归为逻辑表名 player
+	shardTable = regexp.MustCompile(`\b(from|join|into|update|table) ([a-z0-9_$]+\.)?([a-z_$][a-z0-9_$]*?)_\d+\b`)
+)
+
+// Fingerprint 归一化 SQL：去掉注释，字面量替换为 ?，合并空白和 IN 列表，去掉分表后缀，结果转为小写
+func Fingerprint(query string) string {
+	var b strings.Builder
+	b.Grow(len(query))
+
+	space := false
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		switch {
+		case c == '\'' || c == '"':
+			// 字符串，支持反斜杠转义和两个引号转义
+			for i++; i < len(query); i++ {
+				if query[i] == '\\' {
+					i++
+				} else if query[i] == c {
+					if i+1 < len(query) && query[i+1] == c {
+						i++
+						continue
+					}
+					break
+				}
+			}
+			c = '?'
+		case c == '-' && i+1 < len(query) && query[i+1] == '-':
+			for i < len(query) && query[i] != '\n' {
+				i++
+			}
+			space = true
+			continue
+		case c == '/' && i+1 < len(query) && query[i+1] == '*':
+			end := strings.Index(query[i+2:], "*/")
+			if end < 0 {
+				i = len(query)
+			} else {
+				i += end + 3
+			}
+			space = true
+			continue
+		case isDigit(c) && (i == 0 || !isIdent(query[i-1])):
+			for i+1 < len(query) && (isIdent(query[i+1]) || query[i+1] == '.') {
+				i++
+			}
+			c = '?'
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			space = true
+			continue
+		}
+
+		if space && b.Len() > 0 {
+			b.WriteByte(' ')
+		}
+		space = false
+		b.WriteByte(c)
+	}
+
+	fp := strings.ToLower(b.String())
+	fp = inList.ReplaceAllString(fp, "(?+)")
+	fp = valuesList.ReplaceAllString(fp, "(?+)")
+	fp = shardTable.ReplaceAllString(fp, "$1 $2$3")
+	if len(fp) > maxFingerprintLen {
+		// 不能截断在多字节字符中间
+		cut := maxFingerprintLen
+		for cut > 0 && !utf8.RuneStart(fp[cut]) {
+			cut--
+		}
+		fp = fp[:cut]
+	}
+	return fp
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isIdent(c byte) bool {
+	return isDigit(c) || c == '_' || c == '$' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= 0x80
+}
+
+// redact 慢查询日志中的参数只保留数字等类型的值，字符串和其他类型只记录类型和长度
+func redact(args []interface{}) []string {
+	result := make([]string, 0, len(args))
+	for _, arg := range args {
+		switch v := arg.(type) {
+		case nil:
+			result = append(result, "NULL")
+		case bool, int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64, time.Time:
+			result = append(result, fmt.Sprint(v))
+		case string:
+			result = append(result, fmt.Sprintf("string(%d)", len(v)))
+		case []byte:
+			result = append(result, fmt.Sprintf("bytes(%d)", len(v)))
+		default:
+			result = append(result, fmt.Sprintf("%T", v))
+		}
+	}
+	return result
+}
+
+// caller 本包之外的第一个调用者，通常是 dao 的方法
+func caller() string {
+	pcs := make([]uintptr, 16)
+	n := runtime.Callers(3, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+	for {
+		frame, more := frames.Next()
+		if !strings.HasPrefix(frame.Function, pkgPath+".") {
+			return fmt.Sprintf("%s:%d", frame.File, frame.Line)
+		}
+		if !more {
+			return ""
+		}
+	}
+}
+
+// stat 记录监控和 trace，超过慢查询阈值时打印日志
+func (s session) stat(ctx context.Context, method, query string, args []interface{}) (context.Context, func(err error)) {
+	fp := Fingerprint(query)
+	ctx, span := trace.StartSpan(ctx, "mysql."+method, trace.WithSpanKind(trace.SpanKindClient))
+	span.AddAttributes(
+		trace.StringAttribute("db.system", "mysql"),
+		trace.StringAttribute("db.statement", fp),
+		trace.StringAttribute("net.peer.name", s.instance),
+	)
+
+	begin := time.Now()
+	statHandler := monitoring.GetRecordMysqlCallStatsHandler(method, s.instance, fp)
+	return ctx, func(err error) {
+		statHandler(err)
+
+		if err != nil {
+			span.SetStatus(trace.Status{Code: trace.StatusCodeUnknown, Message: err.Error()})
+		}
+		span.End()
+
+		cost := time.Since(begin)
+		if s.slow > 0 && cost >= s.slow {
+			log.Warn().Str("method", method).Str("instance", s.instance).Str("sql", query).
+				Strs("args", redact(args)).Dur("cost", cost).Str("caller", caller()).Err(err).
+				Msg("mysql slow query")
+		}
+	}
+}
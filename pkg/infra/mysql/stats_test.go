@@ -0,0 +1,43 @@
+package mysql
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestFingerprint(t *testing.T) {
+	cases := map[string]string{
+		"SELECT * FROM player WHERE id = 42 AND name = 'o''neil'":       "select * from player where id = ? and name = ?",
+		"select  *\n\tfrom player_3 -- shard\nwhere id in (1, 2, 3)":    "select * from player where id in (?+)",
+		"SELECT a.* FROM db_0.player_12 a JOIN bag_3 b ON a.id = b.uid": "select a.* from db_0.player a join bag b on a.id = b.uid",
+		"UPDATE log_2024_7 SET v = ? WHERE t_2fa = ?":                   "update log_2024 set v = ? where t_2fa = ?",
+		"INSERT INTO t (a, b) VALUES (?, ?), (?, ?) /* batch */":        "insert into t (a, b) values (?+)",
+		`UPDATE t SET v = "x\"y", w = 1.5e3 WHERE k = ?`:                "update t set v = ?, w = ? where k = ?",
+	}
+
+	for query, expect := range cases {
+		if fp := Fingerprint(query); fp != expect {
+			t.Errorf("Fingerprint(%q) = %q, expect %q", query, fp, expect)
+		}
+	}
+}
+
+func TestFingerprintTruncate(t *testing.T) {
+	// 标识符中的非 ASCII 字符不会被替换，截断位置落在多字节字符中间
+	query := "select c_" + strings.Repeat("字段", 60) + " from player"
+	fp := Fingerprint(query)
+	if !utf8.ValidString(fp) {
+		t.Fatalf("fingerprint is not valid utf8: %q", fp)
+	}
+	if len(fp) > maxFingerprintLen || len(fp) < maxFingerprintLen-utf8.UTFMax {
+		t.Fatalf("unexpected fingerprint length %v", len(fp))
+	}
+}
+
+func TestRedact(t *testing.T) {
+	got := redact([]interface{}{1, "secret", []byte("pw"), nil})
+	if got[0] != "1" || got[1] != "string(6)" || got[2] != "bytes(2)" || got[3] != "NULL" {
+		t.Fatalf("unexpected redacted args %v", got)
+	}
+}
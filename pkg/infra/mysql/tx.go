@@ -0,0 +1,117 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+var _ TxClient = (*txClient)(nil)
+
+// TxFunc 返回 nil 时提交，返回错误或 panic 时回滚
+type TxFunc func(tx TxClient) error
+
+// TxClient 事务内执行语句，与 Client 的同名方法用法一致
+type TxClient interface {
+	QuerySingle(ctx context.Context, dest interface{}, query string, args ...interface{}) error
+	QueryMulti(ctx context.Context, dest interface{}, query string, args ...interface{}) error
+	QueryRows(ctx context.Context, query string, args ...interface{}) (Rows, error)
+	QueryEach(ctx context.Context, dest interface{}, fn func() error, query string, args ...interface{}) error
+	QueryKeyset(ctx context.Context, ks Keyset, dest interface{}, fn KeyFunc) error
+	Insert(ctx context.Context, query string, args ...interface{}) (int64, error)
+	InsertNamed(ctx context.Context, query string, arg interface{}) (int64, error)
+	Update(ctx context.Context, query string, args ...interface{}) (int64, error)
+	UpdateNamed(ctx context.Context, query string, arg interface{}) (int64, error)
+	Exec(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	ReplaceIntoMulti(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	IsNoRowsError(err error) bool
+
+	// WithTx 嵌套事务，通过 savepoint 实现，失败时只回滚到 savepoint
+	WithTx(ctx context.Context, fn TxFunc) error
+}
+
+// IsNoRowsError ...
+func IsNoRowsError(err error) bool {
+	return errors.Cause(err) == sql.ErrNoRows
+}
+
+// WithTx 在主库上开启事务，opts 为 nil 时使用默认隔离级别
+func (c *client) WithTx(ctx context.Context, opts *sql.TxOptions, fn TxFunc) (err error) {
+	n := c.lb.writer()
+	s := session{instance: n.instance, slow: n.slow}
+	_, statHandler := s.stat(ctx, "Begin", "BEGIN", nil)
+	tx, err := n.db.BeginTxx(ctx, opts)
+	statHandler(err)
+	if err != nil {
+		return errors.Wrap(err, "begin")
+	}
+
+	s.e = tx
+	t := &txClient{session: s}
+	defer func() {
+		if p := recover(); p != nil {
+			_ = t.finish(ctx, "Rollback", tx.Rollback)
+			panic(p)
+		}
+
+		if err != nil {
+			if e := t.finish(ctx, "Rollback", tx.Rollback); e != nil {
+				err = errors.Wrapf(err, "rollback: %v", e)
+			}
+			return
+		}
+
+		if err = t.finish(ctx, "Commit", tx.Commit); err != nil {
+			err = errors.Wrap(err, "commit")
+		}
+	}()
+
+	return fn(t)
+}
+
+type txClient struct {
+	session
+	depth int
+}
+
+func (t *txClient) finish(ctx context.Context, method string, fn func() error) error {
+	_, statHandler := t.stat(ctx, method, strings.ToUpper(method), nil)
+	err := fn()
+	statHandler(err)
+	return err
+}
+
+func (t *txClient) IsNoRowsError(err error) bool {
+	return IsNoRowsError(err)
+}
+
+func (t *txClient) WithTx(ctx context.Context, fn TxFunc) (err error) {
+	name := fmt.Sprintf("sp_%d", t.depth+1)
+	if _, err = t.e.ExecContext(ctx, "SAVEPOINT "+name); err != nil {
+		return errors.Wrapf(err, "savepoint %v", name)
+	}
+
+	nested := &txClient{session: t.session, depth: t.depth + 1}
+	defer func() {
+		if p := recover(); p != nil {
+			_, _ = t.e.ExecContext(ctx, "ROLLBACK TO SAVEPOINT "+name)
+			panic(p)
+		}
+
+		if err != nil {
+			if _, e := t.e.ExecContext(ctx, "ROLLBACK TO SAVEPOINT "+name); e != nil {
+				err = errors.Wrapf(err, "rollback to savepoint %v: %v", name, e)
+			}
+			return
+		}
+
+		if _, err = t.e.ExecContext(ctx, "RELEASE SAVEPOINT "+name); err != nil {
+			err = errors.Wrapf(err, "release savepoint %v", name)
+		}
+	}()
+
+	return fn(nested)
+}
@@ -46,6 +46,14 @@ func (h *NameHolder) encode() ([]byte, error) {
 	return json.Marshal(h)
 }
 
+// NewNamed 使用已有的 kv 存储分配节点编号
+func NewNamed(kvStore store.Store) NodeNamed {
+	return &nodeNamed{
+		Store:      kvStore,
+		retryCount: retryCount,
+	}
+}
+
 func NewConsulNamed(addr string) (NodeNamed, error) {
 	kvStore, err := libkv.NewStore(
 		store.CONSUL,
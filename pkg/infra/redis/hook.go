@@ -0,0 +1,145 @@
+package redis
+
+import (
+	"context"
+	"time"
+
+	"template/pkg/infra/monitoring"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/rs/zerolog/log"
+	"go.opencensus.io/trace"
+)
+
+var _ redis.Hook = (*hook)(nil)
+
+type startKey struct{}
+
+type start struct {
+	at      time.Time
+	span    *trace.Span
+	records []func(err error)
+}
+
+// NewHook 记录命令的监控、trace 和慢日志，instance 为节点地址，slow 为 0 时不打印慢日志
+func NewHook(instance string, slow time.Duration) redis.Hook {
+	return &hook{instance: instance, slow: slow}
+}
+
+// NewClusterNodeClient 用于 ClusterOptions.NewClient，集群的每个节点按自己的地址记录
+func NewClusterNodeClient(slow time.Duration) func(opt *redis.Options) *redis.Client {
+	return func(opt *redis.Options) *redis.Client {
+		cli := redis.NewClient(opt)
+		cli.AddHook(NewHook(opt.Addr, slow))
+		return cli
+	}
+}
+
+type hook struct {
+	instance string
+	slow     time.Duration
+}
+
+func (h *hook) begin(ctx context.Context, cmds []redis.Cmder, name string, attrs ...trace.Attribute) context.Context {
+	records := make([]func(err error), 0, len(cmds))
+	for _, cmd := range cmds {
+		records = append(records, monitoring.GetRecordRedisCallStatsHandler(cmd.Name(), h.instance))
+	}
+
+	ctx, span := trace.StartSpan(ctx, "redis."+name, trace.WithSpanKind(trace.SpanKindClient))
+	span.AddAttributes(append(attrs,
+		trace.StringAttribute("db.system", "redis"),
+		trace.StringAttribute("net.peer.name", h.instance),
+	)...)
+	return context.WithValue(ctx, startKey{}, &start{at: time.Now(), span: span, records: records})
+}
+
+// end 返回开始时间，没有经过 begin 时为 nil
+func (h *hook) end(ctx context.Context, err error) *start {
+	s, ok := ctx.Value(startKey{}).(*start)
+	if !ok {
+		return nil
+	}
+
+	if err != nil {
+		s.span.SetStatus(trace.Status{Code: trace.StatusCodeUnknown, Message: err.Error()})
+	}
+	s.span.End()
+	return s
+}
+
+func (h *hook) BeforeProcess(ctx context.Context, cmd redis.Cmder) (context.Context, error) {
+	return h.begin(ctx, []redis.Cmder{cmd}, cmd.Name()), nil
+}
+
+func (h *hook) AfterProcess(ctx context.Context, cmd redis.Cmder) error {
+	err := cmdErr(cmd)
+	s := h.end(ctx, err)
+	if s == nil {
+		return nil
+	}
+
+	s.records[0](err)
+	h.logSlow("command", cmd.Name(), key(cmd), s.at)
+	return nil
+}
+
+func (h *hook) BeforeProcessPipeline(ctx context.Context, cmds []redis.Cmder) (context.Context, error) {
+	return h.begin(ctx, cmds, "pipeline", trace.Int64Attribute("redis.pipeline.length", int64(len(cmds)))), nil
+}
+
+// AfterProcessPipeline 每个命令单独记录，耗时为整个 pipeline 的耗时
+func (h *hook) AfterProcessPipeline(ctx context.Context, cmds []redis.Cmder) error {
+	var first error
+	for _, cmd := range cmds {
+		if err := cmdErr(cmd); err != nil {
+			first = err
+			break
+		}
+	}
+
+	s := h.end(ctx, first)
+	if s == nil {
+		return nil
+	}
+
+	for i, cmd := range cmds {
+		s.records[i](cmdErr(cmd))
+	}
+
+	if len(cmds) > 0 {
+		h.logSlow("pipeline", cmds[0].Name(), key(cmds[0]), s.at)
+	}
+	return nil
+}
+
+func (h *hook) logSlow(kind, name, key string, at time.Time) {
+	cost := time.Since(at)
+	if h.slow <= 0 || cost < h.slow {
+		return
+	}
+
+	// 只记录命令和 key，参数中可能有敏感数据
+	log.Warn().Str("kind", kind).Str("command", name).Str("key", key).Str("instance", h.instance).
+		Dur("cost", cost).Msg("redis slow command")
+}
+
+// cmdErr redis.Nil 表示 key 不存在，不算错误
+func cmdErr(cmd redis.Cmder) error {
+	if err := cmd.Err(); err != nil && err != redis.Nil {
+		return err
+	}
+	return nil
+}
+
+func key(cmd redis.Cmder) string {
+	args := cmd.Args()
+	if len(args) < 2 {
+		return ""
+	}
+
+	if k, ok := args[1].(string); ok {
+		return k
+	}
+	return ""
+}